@@ -1,61 +1,159 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"log"
 	"os"
+	"os/signal"
 	"pfservice/config"
 	"pfservice/internal/db"
+	"pfservice/internal/httpclient"
+	media "pfservice/internal/media_download"
+	"pfservice/internal/repair"
+	"pfservice/internal/reporting"
+	"syscall"
+
+	"gorm.io/gorm"
+)
+
+// checkProgressEvery is how often progress is printed, in images checked
+const checkProgressEvery = 5000
+
+// Exit codes, so monitoring and CI can tell problems from failures
+const (
+	exitOK       = 0
+	exitProblems = 1 // missing images or variants remain
+	exitError    = 2 // the check itself failed
 )
 
 func main() {
-	config.LoadConfig()
+	repairFlag := flag.Bool("repair", false, "repair missing images and variants, then check again")
+	formatFlag := flag.String("format", "text", "output format: text or json")
+	flag.Parse()
+
+	if *formatFlag != "text" && *formatFlag != "json" {
+		log.Printf("Unknown --format %q, expected text or json", *formatFlag)
+		os.Exit(exitError)
+	}
 
-	// Check if --repair flag is provided
-	repairMode := false
-	if len(os.Args) > 1 && os.Args[1] == "--repair" {
-		repairMode = true
+	config.LoadConfig()
+	if err := media.ConfigureStorage(); err != nil {
+		log.Printf("Media storage error: %v", err)
+		os.Exit(exitError)
 	}
 
-	if repairMode {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *repairFlag {
 		log.Println("PF IMAGE CHECK & REPAIR MODE")
-		log.Println("This will check for missing images and attempt to repair them.")
-		log.Println("Run 'pf_repair' command for full repair functionality.")
 	} else {
 		log.Println("PF IMAGE CHECK MODE")
-		log.Println("Checking for missing images...")
 	}
+	log.Println("Checking for missing images...")
 
 	dbConn := db.Connect()
 
-	// Check for missing images
-	missingImages, err := db.CheckMissingImages(dbConn)
+	run, err := db.StartRun(ctx, dbConn, "pf_check")
 	if err != nil {
-		log.Fatalf("Failed to check missing images: %v", err)
+		log.Printf("Warning: Failed to record run: %v", err)
+	}
+	finish := func(status db.RunStatus, stats reporting.ReportStats, errorSummary string) {
+		// Not cancelled with ctx so an aborted run is still recorded
+		if err := db.FinishRun(context.WithoutCancel(ctx), dbConn, run, status, stats, errorSummary); err != nil {
+			log.Printf("Warning: Failed to record run: %v", err)
+		}
+	}
+	// fail records the run as failed and exits with exitError
+	fail := func(msg string, err error) {
+		log.Printf("%s: %v", msg, err)
+		finish(db.RunFailed, reporting.ReportStats{}, msg+": "+err.Error())
+		os.Exit(exitError)
 	}
 
-	if len(missingImages) == 0 {
-		log.Println("✓ No missing images found. All images are present.")
-		return
+	checked, missingImages, missingVariants, err := check(ctx, dbConn)
+	if err != nil {
+		fail("Check failed", err)
 	}
+	report := newCheckReport(checked, missingImages, missingVariants)
 
-	log.Printf("✗ Found %d missing images:", len(missingImages))
+	if *repairFlag && !report.OK {
+		if err := repair.Prepare(ctx, dbConn); err != nil {
+			fail("Repair failed", err)
+		}
 
-	// Group by property for better reporting
-	missingByProperty := make(map[uint]int)
-	pfIDMap := make(map[uint]string)
-	for _, missing := range missingImages {
-		missingByProperty[missing.PropertyID]++
-		if pfIDMap[missing.PropertyID] == "" {
-			pfIDMap[missing.PropertyID] = missing.PfID
+		result := repair.Variants(ctx, missingVariants, nil)
+		if len(missingImages) > 0 {
+			client := httpclient.NewClient(config.AppConfig)
+			imagesResult, err := repair.Images(ctx, dbConn, client, missingImages, nil)
+			if err != nil {
+				fail("Repair failed", err)
+			}
+			result.ImagesRepaired = imagesResult.ImagesRepaired
+			result.ImagesFailed = imagesResult.ImagesFailed
 		}
+
+		// Report what is still missing after the repair
+		log.Println("Checking again after repair...")
+		checked, missingImages, missingVariants, err = check(ctx, dbConn)
+		if err != nil {
+			fail("Check failed", err)
+		}
+		report = newCheckReport(checked, missingImages, missingVariants)
+		report.setRepair(result)
 	}
 
-	log.Printf("\nMissing images by property:")
-	for propertyID, count := range missingByProperty {
-		pfID := pfIDMap[propertyID]
-		log.Printf("  Property ID %d (pf_id: %s): %d missing images", propertyID, pfID, count)
+	if *formatFlag == "json" {
+		if err := report.writeJSON(os.Stdout); err != nil {
+			log.Printf("Failed to write report: %v", err)
+			os.Exit(exitError)
+		}
+	} else {
+		report.logText()
 	}
 
-	log.Printf("\nTo repair missing images, run: pf_repair")
+	stats, errorSummary := report.runStats()
+	if ctx.Err() != nil {
+		finish(db.RunAborted, stats, errorSummary)
+		log.Println("CHECK INTERRUPTED")
+		os.Exit(exitError)
+	}
+	finish(db.CompletedStatus(stats.Errors), stats, errorSummary)
+	if !report.OK {
+		os.Exit(exitProblems)
+	}
+	os.Exit(exitOK)
 }
 
+// check scans every image record, printing progress as files are checked,
+// then checks the resized variants of the images that are present
+func check(ctx context.Context, dbConn *gorm.DB) (int, []db.MissingImageInfo, []db.MissingVariantInfo, error) {
+	var missingImages []db.MissingImageInfo
+	checked := 0
+	var scanErr error
+	for check := range db.ScanImages(ctx, dbConn) {
+		// Keep draining so the scan's workers can exit
+		if check.Err != nil {
+			scanErr = check.Err
+			continue
+		}
+		checked++
+		if !check.Exists {
+			missingImages = append(missingImages, check.Image)
+		}
+		if checked%checkProgressEvery == 0 {
+			log.Printf("Checked %d images, %d missing so far...", checked, len(missingImages))
+		}
+	}
+	if scanErr != nil {
+		return 0, nil, nil, scanErr
+	}
+	log.Printf("Checked %d images", checked)
+
+	missingVariants, err := db.CheckMissingVariants(ctx, dbConn)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	return checked, missingImages, missingVariants, nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"pfservice/internal/db"
+	"pfservice/internal/repair"
+	"pfservice/internal/reporting"
+	"sort"
+	"strings"
+)
+
+// checkReport is the result of a check, printed as text or JSON
+type checkReport struct {
+	Checked       int `json:"checked"`
+	MissingImages int `json:"missing_images"`
+	// MissingVariants counts images with at least one missing variant
+	MissingVariants int              `json:"missing_variants"`
+	Properties      []propertyReport `json:"properties"`
+	Repair          *repairReport    `json:"repair,omitempty"`
+	OK              bool             `json:"ok"`
+}
+
+// propertyReport lists the problems found for one property
+type propertyReport struct {
+	PropertyID      uint            `json:"property_id"`
+	PfID            string          `json:"pf_id"`
+	MissingImages   []imageReport   `json:"missing_images,omitempty"`
+	MissingVariants []variantReport `json:"missing_variants,omitempty"`
+}
+
+type imageReport struct {
+	ImageID uint   `json:"image_id"`
+	Path    string `json:"path"`
+}
+
+type variantReport struct {
+	ImageID  uint     `json:"image_id"`
+	Path     string   `json:"path"`
+	Variants []string `json:"variants"`
+}
+
+// repairReport is what --repair did before the final check
+type repairReport struct {
+	ImagesRepaired    int `json:"images_repaired"`
+	ImagesFailed      int `json:"images_failed"`
+	VariantsGenerated int `json:"variants_generated"`
+	VariantsFailed    int `json:"variants_failed"`
+}
+
+// newCheckReport groups the missing images and variants by property,
+// ordered by property ID
+func newCheckReport(checked int, missingImages []db.MissingImageInfo, missingVariants []db.MissingVariantInfo) *checkReport {
+	report := &checkReport{
+		Checked:         checked,
+		MissingImages:   len(missingImages),
+		MissingVariants: len(missingVariants),
+		Properties:      []propertyReport{},
+		OK:              len(missingImages) == 0 && len(missingVariants) == 0,
+	}
+
+	byProperty := make(map[uint]*propertyReport)
+	property := func(propertyID uint, pfID string) *propertyReport {
+		p, ok := byProperty[propertyID]
+		if !ok {
+			p = &propertyReport{PropertyID: propertyID, PfID: pfID}
+			byProperty[propertyID] = p
+		}
+		return p
+	}
+
+	for _, missing := range missingImages {
+		p := property(missing.PropertyID, missing.PfID)
+		p.MissingImages = append(p.MissingImages, imageReport{ImageID: missing.ImageID, Path: missing.ImagePath})
+	}
+	for _, missing := range missingVariants {
+		p := property(missing.PropertyID, missing.PfID)
+		p.MissingVariants = append(p.MissingVariants, variantReport{ImageID: missing.ImageID, Path: missing.ImagePath, Variants: missing.Variants})
+	}
+
+	for _, p := range byProperty {
+		report.Properties = append(report.Properties, *p)
+	}
+	sort.Slice(report.Properties, func(i, j int) bool {
+		return report.Properties[i].PropertyID < report.Properties[j].PropertyID
+	})
+	return report
+}
+
+// setRepair records the counts from a repair run
+func (r *checkReport) setRepair(result repair.Result) {
+	r.Repair = &repairReport{
+		ImagesRepaired:    result.ImagesRepaired,
+		ImagesFailed:      result.ImagesFailed,
+		VariantsGenerated: result.VariantsGenerated,
+		VariantsFailed:    result.VariantsFailed,
+	}
+}
+
+// runStats returns the counters and error summary recorded in pf_sync_runs.
+// Missing images and images with missing variants count as errors.
+func (r *checkReport) runStats() (reporting.ReportStats, string) {
+	stats := reporting.ReportStats{Errors: r.MissingImages + r.MissingVariants}
+	if r.Repair != nil {
+		stats.ImagesDownloaded = r.Repair.ImagesRepaired
+	}
+	if r.OK {
+		return stats, ""
+	}
+	return stats, fmt.Sprintf("%d missing images, %d images with missing variants", r.MissingImages, r.MissingVariants)
+}
+
+// writeJSON prints the report as indented JSON
+func (r *checkReport) writeJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// logText prints the report as human-readable log lines
+func (r *checkReport) logText() {
+	if r.Repair != nil {
+		log.Printf("Repair: %d images repaired, %d failed; %d variants generated, %d images failed",
+			r.Repair.ImagesRepaired, r.Repair.ImagesFailed, r.Repair.VariantsGenerated, r.Repair.VariantsFailed)
+	}
+
+	if r.MissingImages == 0 {
+		log.Println("✓ No missing images found. All images are present.")
+	} else {
+		log.Printf("✗ Found %d missing images:", r.MissingImages)
+		log.Printf("\nMissing images by property:")
+		for _, p := range r.Properties {
+			if len(p.MissingImages) > 0 {
+				log.Printf("  Property ID %d (pf_id: %s): %d missing images", p.PropertyID, p.PfID, len(p.MissingImages))
+			}
+		}
+	}
+
+	if r.MissingVariants == 0 {
+		log.Println("✓ No missing image variants found.")
+	} else {
+		log.Printf("✗ Found %d images with missing variants:", r.MissingVariants)
+		for _, p := range r.Properties {
+			for _, missing := range p.MissingVariants {
+				log.Printf("  Property ID %d (pf_id: %s): %s missing %s", p.PropertyID, p.PfID, missing.Path, strings.Join(missing.Variants, ", "))
+			}
+		}
+	}
+
+	if !r.OK && r.Repair == nil {
+		log.Printf("\nTo repair missing images and variants, run: pf_check --repair or pf_repair")
+	}
+}
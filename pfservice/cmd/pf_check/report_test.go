@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"pfservice/internal/db"
+	"testing"
+)
+
+func TestNewCheckReportGroupsByProperty(t *testing.T) {
+	missingImages := []db.MissingImageInfo{
+		{ImageID: 7, PropertyID: 20, PfID: "pf-20", ImagePath: "property_images/c.jpg"},
+		{ImageID: 3, PropertyID: 10, PfID: "pf-10", ImagePath: "property_images/a.jpg"},
+		{ImageID: 4, PropertyID: 10, PfID: "pf-10", ImagePath: "property_images/b.jpg"},
+	}
+	missingVariants := []db.MissingVariantInfo{
+		{ImageID: 9, PropertyID: 30, PfID: "pf-30", ImagePath: "property_images/d.jpg", Variants: []string{"thumb"}},
+		{ImageID: 8, PropertyID: 20, PfID: "pf-20", ImagePath: "property_images/e.jpg", Variants: []string{"medium", "large"}},
+	}
+
+	report := newCheckReport(100, missingImages, missingVariants)
+
+	if report.OK {
+		t.Error("Report with missing images should not be OK")
+	}
+	if report.Checked != 100 || report.MissingImages != 3 || report.MissingVariants != 2 {
+		t.Errorf("Unexpected counts: %+v", report)
+	}
+	if len(report.Properties) != 3 {
+		t.Fatalf("Expected 3 properties, got %d", len(report.Properties))
+	}
+	for i, want := range []uint{10, 20, 30} {
+		if report.Properties[i].PropertyID != want {
+			t.Errorf("Property %d: expected ID %d, got %d", i, want, report.Properties[i].PropertyID)
+		}
+	}
+	if got := report.Properties[0]; len(got.MissingImages) != 2 || got.PfID != "pf-10" {
+		t.Errorf("Property 10: unexpected report %+v", got)
+	}
+	if got := report.Properties[1]; len(got.MissingImages) != 1 || len(got.MissingVariants) != 1 {
+		t.Errorf("Property 20: expected 1 missing image and 1 missing variant, got %+v", got)
+	}
+
+	stats, summary := report.runStats()
+	if stats.Errors != 5 {
+		t.Errorf("Expected 5 errors in run stats, got %d", stats.Errors)
+	}
+	if summary != "3 missing images, 2 images with missing variants" {
+		t.Errorf("Unexpected error summary %q", summary)
+	}
+}
+
+func TestCheckReportJSON(t *testing.T) {
+	report := newCheckReport(5, nil, nil)
+	if !report.OK {
+		t.Error("Report without problems should be OK")
+	}
+
+	var buf bytes.Buffer
+	if err := report.writeJSON(&buf); err != nil {
+		t.Fatalf("writeJSON failed: %v", err)
+	}
+
+	var decoded map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	// An empty list, not null, so consumers can iterate it
+	if props, ok := decoded["properties"].([]any); !ok || len(props) != 0 {
+		t.Errorf("Expected empty properties list, got %v", decoded["properties"])
+	}
+	if _, ok := decoded["repair"]; ok {
+		t.Error("repair should be omitted when no repair ran")
+	}
+	if decoded["ok"] != true {
+		t.Errorf("Expected ok=true, got %v", decoded["ok"])
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"pfservice/config"
+	"pfservice/internal/db"
+	media "pfservice/internal/media_download"
+	"pfservice/internal/reporting"
+	"syscall"
+	"time"
+)
+
+func main() {
+	quarantineFlag := flag.Bool("quarantine", false, "move orphaned files to the quarantine directory")
+	deleteFlag := flag.Bool("delete", false, "delete orphaned files")
+	graceFlag := flag.Duration("grace", 7*24*time.Hour, "only touch files not modified for this long")
+	flag.Parse()
+
+	if *quarantineFlag && *deleteFlag {
+		log.Fatal("--quarantine and --delete cannot be used together")
+	}
+
+	config.LoadConfig()
+	if err := media.ConfigureStorage(); err != nil {
+		log.Fatalf("Media storage error: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	switch {
+	case *quarantineFlag:
+		log.Println("PF MEDIA GC: QUARANTINE MODE")
+	case *deleteFlag:
+		log.Println("PF MEDIA GC: DELETE MODE")
+	default:
+		log.Println("PF MEDIA GC: REPORT MODE (nothing is changed)")
+	}
+
+	dbConn := db.Connect()
+
+	run, err := db.StartRun(ctx, dbConn, "pf_gc")
+	if err != nil {
+		log.Printf("Warning: Failed to record run: %v", err)
+	}
+	finish := func(status db.RunStatus, stats reporting.ReportStats, errorSummary string) {
+		// Not cancelled with ctx so an aborted run is still recorded
+		if err := db.FinishRun(context.WithoutCancel(ctx), dbConn, run, status, stats, errorSummary); err != nil {
+			log.Printf("Warning: Failed to record run: %v", err)
+		}
+	}
+	fatal := func(msg string) {
+		finish(db.RunFailed, reporting.ReportStats{}, msg)
+		log.Fatal(msg)
+	}
+
+	referenced, err := db.ReferencedImagePaths(ctx, dbConn)
+	if err != nil {
+		fatal(fmt.Sprintf("Failed to load image paths: %v", err))
+	}
+	// An empty table almost certainly means the wrong database
+	if len(referenced) == 0 && (*quarantineFlag || *deleteFlag) {
+		fatal("No image records found in the database, refusing to remove files")
+	}
+
+	scan, err := media.FindOrphans(ctx, "property_images", referenced, *graceFlag, time.Now())
+	if err != nil {
+		fatal(fmt.Sprintf("Failed to scan media files: %v", err))
+	}
+
+	for _, f := range scan.Orphans {
+		log.Printf("  orphan: %s (%s, modified %s)", f.Path, formatBytes(f.Size), f.ModTime.Format("2006-01-02"))
+	}
+	log.Printf("Scanned %d files, %d referenced by %d image records", scan.Scanned, scan.Scanned-len(scan.Orphans)-len(scan.Recent), len(referenced))
+	log.Printf("Found %d orphaned files, %s in total", len(scan.Orphans), formatBytes(scan.OrphanBytes))
+	if len(scan.Recent) > 0 {
+		log.Printf("Kept %d unreferenced files modified within the last %v", len(scan.Recent), *graceFlag)
+	}
+
+	if !*quarantineFlag && !*deleteFlag {
+		finish(db.RunSucceeded, reporting.ReportStats{}, "")
+		if len(scan.Orphans) > 0 {
+			log.Println("To remove them, run: pf_gc --quarantine (or --delete)")
+		}
+		return
+	}
+
+	removed, failed := 0, 0
+	var removedBytes int64
+	for _, f := range scan.Orphans {
+		if ctx.Err() != nil {
+			break
+		}
+
+		if *quarantineFlag {
+			// Each orphaned file, variants included, is moved on its own
+			dst, err := media.QuarantineFile(ctx, f.Path)
+			if err != nil {
+				log.Printf("Failed to quarantine %s: %v", f.Path, err)
+				failed++
+				continue
+			}
+			log.Printf("Moved %s to %s", f.Path, dst)
+		} else {
+			if err := media.Store.Delete(ctx, f.Path); err != nil {
+				log.Printf("Failed to delete %s: %v", f.Path, err)
+				failed++
+				continue
+			}
+			log.Printf("Deleted %s", f.Path)
+		}
+		removed++
+		removedBytes += f.Size
+	}
+
+	// Removed files are counted as retired images
+	stats := reporting.ReportStats{ImagesRetired: removed, Errors: failed}
+	var errorSummary string
+	if failed > 0 {
+		errorSummary = fmt.Sprintf("%d orphaned files could not be removed", failed)
+	}
+
+	if ctx.Err() != nil {
+		finish(db.RunAborted, stats, errorSummary)
+		log.Printf("GC INTERRUPTED: %d files (%s) removed, %d failed", removed, formatBytes(removedBytes), failed)
+		return
+	}
+	finish(db.CompletedStatus(failed), stats, errorSummary)
+	log.Printf("GC FINISHED: %d files (%s) removed, %d failed", removed, formatBytes(removedBytes), failed)
+}
+
+// formatBytes prints n in B, KB, MB or GB
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	value, suffix := float64(n)/unit, "KB"
+	for _, s := range []string{"MB", "GB"} {
+		if value < unit {
+			break
+		}
+		value, suffix = value/unit, s
+	}
+	return fmt.Sprintf("%.1f %s", value, suffix)
+}
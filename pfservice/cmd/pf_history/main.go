@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"pfservice/config"
+	"pfservice/internal/db"
+	"pfservice/internal/property"
+	"strings"
+	"syscall"
+)
+
+func main() {
+	pfIDFlag := flag.String("pf-id", "", "Property Finder ID of the listing to show")
+	flag.Parse()
+
+	if *pfIDFlag == "" {
+		log.Fatal("--pf-id is required")
+	}
+
+	config.LoadConfig()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	dbConn := db.Connect()
+
+	events, err := db.ListingHistory(ctx, dbConn, *pfIDFlag)
+	if err != nil {
+		log.Fatalf("Failed to load history: %v", err)
+	}
+
+	if len(events) == 0 {
+		fmt.Printf("No sync events recorded for %s\n", *pfIDFlag)
+	} else {
+		fmt.Printf("Sync history of %s (%d events):\n", *pfIDFlag, len(events))
+		for _, e := range events {
+			fmt.Println(formatEvent(e))
+		}
+	}
+
+	var prop property.DjangoProperty
+	if err := dbConn.WithContext(ctx).Where("pf_id = ?", *pfIDFlag).First(&prop).Error; err != nil {
+		return
+	}
+	changes, err := db.PropertyHistory(ctx, dbConn, prop.ID, "")
+	if err != nil {
+		log.Fatalf("Failed to load field changes: %v", err)
+	}
+	if len(changes) == 0 {
+		return
+	}
+
+	fmt.Printf("\nField changes of property %d (%d changes):\n", prop.ID, len(changes))
+	for _, c := range changes {
+		fmt.Println(formatChange(c))
+	}
+}
+
+// formatChange prints one field change as a timeline line
+func formatChange(c db.PropertyChange) string {
+	run := "-"
+	if c.RunID != 0 {
+		run = fmt.Sprint(c.RunID)
+	}
+	return fmt.Sprintf("%s  run %-6s %-17s %s -> %s", c.ChangedAt.Format("2006-01-02 15:04:05"), run, c.Field, c.OldValue, c.NewValue)
+}
+
+// formatEvent prints one event as a timeline line
+func formatEvent(e db.ListingEvent) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s  ", e.CreatedAt.Format("2006-01-02 15:04:05"))
+	if e.RunID != 0 {
+		fmt.Fprintf(&b, "run %-6d ", e.RunID)
+	} else {
+		b.WriteString("run -      ")
+	}
+	command := e.Command
+	if command == "" {
+		command = "-"
+	}
+	fmt.Fprintf(&b, "%-10s %-14s", command, e.Action)
+	if e.PropertyID != 0 {
+		fmt.Fprintf(&b, " property %d", e.PropertyID)
+	}
+	if e.Detail != "" {
+		b.WriteString(" " + e.Detail)
+	}
+	if e.Error != "" {
+		b.WriteString(" error: " + e.Error)
+	}
+	return b.String()
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"pfservice/internal/db"
+	"testing"
+	"time"
+)
+
+func TestFormatEvent(t *testing.T) {
+	at := time.Date(2026, 3, 1, 0, 5, 9, 0, time.UTC)
+
+	tests := []struct {
+		event db.ListingEvent
+		want  string
+	}{
+		{
+			db.ListingEvent{SyncEvent: db.SyncEvent{RunID: 42, PropertyID: 1061, Action: db.EventCreated, CreatedAt: at}, Command: "pf_sync"},
+			"2026-03-01 00:05:09  run 42     pf_sync    created        property 1061",
+		},
+		{
+			db.ListingEvent{SyncEvent: db.SyncEvent{RunID: 42, PropertyID: 1061, Action: db.EventImageFailed, Detail: "https://example.com/a.jpg", Error: "status 404", CreatedAt: at}, Command: "pf_repair"},
+			"2026-03-01 00:05:09  run 42     pf_repair  image_failed   property 1061 https://example.com/a.jpg error: status 404",
+		},
+		{
+			db.ListingEvent{SyncEvent: db.SyncEvent{Action: db.EventAgentMissing, Error: "agent 7 not found", CreatedAt: at}},
+			"2026-03-01 00:05:09  run -      -          agent_missing  error: agent 7 not found",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := formatEvent(tt.event); got != tt.want {
+			t.Errorf("formatEvent() =\n%q\nwant\n%q", got, tt.want)
+		}
+	}
+}
+
+func TestFormatChange(t *testing.T) {
+	at := time.Date(2026, 3, 2, 0, 4, 0, 0, time.UTC)
+
+	got := formatChange(db.PropertyChange{RunID: 42, Field: "price", OldValue: "1500000", NewValue: "1350000", ChangedAt: at})
+	want := "2026-03-02 00:04:00  run 42     price             1500000 -> 1350000"
+	if got != want {
+		t.Errorf("formatChange() =\n%q\nwant\n%q", got, want)
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"pfservice/config"
+	"pfservice/internal/area"
+	"pfservice/internal/db"
+	"pfservice/internal/httpclient"
+	"pfservice/internal/plan"
+	"pfservice/internal/property"
+	"pfservice/internal/users"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// dryRun fetches all listings, only those updated since a non-zero since, or
+// only targets when given, and prints the writes a sync would make as JSON on
+// stdout. Nothing is written to Postgres or MEDIA_ROOT.
+func dryRun(ctx context.Context, dbConn *gorm.DB, client *httpclient.Client, allPFUsers []users.PFUser, retire db.RetirePolicy, targets *targetSet, since time.Time) error {
+	p := plan.New("pf_sync")
+	plannedUsers := make(map[string]bool)
+	seen := make(map[string]bool)
+
+	if targets != nil {
+		p.Targeted = true
+		p.HideSkipped = "targeted run"
+		for _, failure := range targets.Failures {
+			p.Skipped = append(p.Skipped, plan.Skip{Key: failure.Key, Reason: failure.Err.Error()})
+		}
+		for _, listing := range targets.Listings {
+			if err := planListing(ctx, dbConn, p, plannedUsers, allPFUsers, listing, retire); err != nil {
+				return err
+			}
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return p.Write(os.Stdout)
+	}
+
+	pager := client.NewListingPager()
+	pager.UpdatedSince = since
+	if !since.IsZero() {
+		p.UpdatedSince = &since
+	}
+	for ctx.Err() == nil {
+		listings, err := pager.Next(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			if pager.Page() == 0 {
+				return fmt.Errorf("fetch listings: %w", err)
+			}
+			log.Printf("PF Listings error on page %d, stopping pagination: %v", pager.Page()+1, err)
+			break
+		}
+		if listings == nil {
+			break
+		}
+
+		for _, listing := range listings {
+			seen[listing.ID] = true
+			if err := planListing(ctx, dbConn, p, plannedUsers, allPFUsers, listing, retire); err != nil {
+				return err
+			}
+		}
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	p.Complete = pager.Complete()
+	if p.Complete && p.UpdatedSince != nil {
+		p.HideSkipped = "incremental run"
+	} else if p.Complete {
+		missing, visible, err := db.FindMissingListings(ctx, dbConn, seen)
+		if err != nil {
+			return err
+		}
+		p.Hides = missing
+		if err := db.CheckHideThreshold(len(missing), visible, config.AppConfig.HideMaxPercent); err != nil {
+			p.HideSkipped = err.Error()
+		}
+	} else {
+		p.HideSkipped = "listings pagination stopped early"
+	}
+
+	return p.Write(os.Stdout)
+}
+
+// planListing adds the user, property and image writes processListing would
+// make for listing to p
+func planListing(
+	ctx context.Context,
+	dbConn *gorm.DB,
+	p *plan.Plan,
+	plannedUsers map[string]bool,
+	allPFUsers []users.PFUser,
+	listing property.PFListing,
+	retire db.RetirePolicy,
+) error {
+	pfAgent := findAgent(allPFUsers, listing.AssignedTo.ID)
+	if pfAgent == nil {
+		p.Skipped = append(p.Skipped, plan.Skip{
+			Key:    listing.ID,
+			Reason: fmt.Sprintf("agent %d not found", listing.AssignedTo.ID),
+		})
+		return nil
+	}
+
+	djUser := pfAgent.ToDjangoUser()
+	if !plannedUsers[djUser.Email] {
+		plannedUsers[djUser.Email] = true
+		action, fields, err := db.PlanUser(ctx, dbConn, djUser)
+		if err != nil {
+			return err
+		}
+		if action != db.ActionNone {
+			p.Users = append(p.Users, plan.Change{Action: string(action), Key: djUser.Email, Fields: fields})
+		}
+	}
+
+	prop := listing.ToDjangoProperty(nil, area.MapPFToDjangoArea(listing.Location.ID))
+	action, fields, existing, err := db.PlanProperty(ctx, dbConn, prop)
+	if err != nil {
+		return err
+	}
+	if action != db.ActionNone {
+		p.Properties = append(p.Properties, plan.Change{Action: string(action), Key: prop.PfID, Fields: fields})
+	}
+
+	imageURLs := make([]string, len(listing.Media.Images))
+	for idx, img := range listing.Media.Images {
+		imageURLs[idx] = img.Original.URL
+	}
+
+	propID := uint(0)
+	if existing != nil {
+		propID = existing.ID
+	}
+
+	// Same matching as processListing
+	stored, err := loadStoredImages(ctx, dbConn, propID, imageURLs)
+	if err != nil {
+		return err
+	}
+	queued := make(map[string]bool)
+
+	for _, missing := range stored.missing {
+		if missing.index < 0 {
+			p.Skipped = append(p.Skipped, plan.Skip{
+				Key:    missing.image.Image,
+				Reason: "no matching image in listing",
+			})
+			continue
+		}
+
+		url := imageURLs[missing.index]
+		if queued[url] {
+			continue
+		}
+		queued[url] = true
+		p.Images = append(p.Images, plan.Image{
+			Action:     "redownload",
+			PfID:       prop.PfID,
+			PropertyID: propID,
+			ImageID:    missing.image.ID,
+			URL:        url,
+			Path:       missing.image.Image,
+		})
+	}
+
+	if propID != 0 && retire != db.RetireKeep {
+		retired, err := db.FindRetiredImages(ctx, dbConn, propID, imageURLs)
+		if err != nil {
+			return err
+		}
+		for _, img := range retired {
+			p.Images = append(p.Images, plan.Image{
+				Action:     "retire",
+				PfID:       prop.PfID,
+				PropertyID: propID,
+				ImageID:    img.ID,
+				Path:       img.Image,
+			})
+		}
+	}
+
+	// The stored path of a new image depends on its content, so it is not planned
+	for idx, url := range imageURLs {
+		if url == "" || queued[url] || stored.present[idx] {
+			continue
+		}
+
+		p.Images = append(p.Images, plan.Image{
+			Action:     "download",
+			PfID:       prop.PfID,
+			PropertyID: propID,
+			URL:        url,
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"pfservice/internal/db"
+	media "pfservice/internal/media_download"
+	"pfservice/internal/property"
+
+	"gorm.io/gorm"
+)
+
+// storedImages is what a property already has for the images of its listing
+type storedImages struct {
+	// missing are active images whose file is gone
+	missing []missingImage
+	// present marks listing image indices whose file is already stored;
+	// they are not downloaded again
+	present map[int]bool
+	// hashes maps the content hash of stored files to their image IDs
+	hashes map[string]uint
+}
+
+// missingImage is an image record whose file is gone, with the index of the
+// listing image it was downloaded from, or -1 if it is no longer listed
+type missingImage struct {
+	image property.DjangoPropertyImage
+	index int
+}
+
+// loadStoredImages matches the property's active images against imageURLs,
+// the listing's images in Property Finder order. Retired images are ignored.
+func loadStoredImages(ctx context.Context, dbConn *gorm.DB, propertyID uint, imageURLs []string) (storedImages, error) {
+	stored := storedImages{
+		present: make(map[int]bool),
+		hashes:  make(map[string]uint),
+	}
+	if propertyID == 0 {
+		return stored, nil
+	}
+
+	var images []property.DjangoPropertyImage
+	if err := dbConn.WithContext(ctx).Where("property_id = ?", propertyID).Order("id").Find(&images).Error; err != nil {
+		return stored, fmt.Errorf("list images for property %d: %w", propertyID, err)
+	}
+
+	ids := make([]uint, 0, len(images))
+	for _, img := range images {
+		ids = append(ids, img.ID)
+	}
+	sources, err := db.GetImageSources(ctx, dbConn, ids)
+	if err != nil {
+		return stored, err
+	}
+
+	for _, img := range images {
+		var src *property.PropertyImageSource
+		if row, ok := sources[img.ID]; ok {
+			src = &row
+		}
+		if src != nil && src.RetiredAt != nil {
+			// Retired on purpose; the file may be in quarantine
+			continue
+		}
+
+		idx := property.MatchImageURL(img, src, imageURLs)
+		if !media.ImageExists(ctx, img.Image) {
+			stored.missing = append(stored.missing, missingImage{image: img, index: idx})
+			continue
+		}
+
+		if idx >= 0 {
+			stored.present[idx] = true
+		}
+
+		hash := ""
+		if src != nil {
+			hash = src.ContentHash
+		}
+		if hash == "" && idx < 0 {
+			// Older file that cannot be matched by URL; a download with the
+			// same content is linked to it instead of stored twice
+			hash, err = media.HashImageFile(ctx, img.Image)
+			if err != nil {
+				log.Printf("Failed to hash image %s: %v", img.Image, err)
+				continue
+			}
+		}
+		if hash != "" {
+			stored.hashes[hash] = img.ID
+		}
+	}
+
+	return stored, nil
+}
@@ -1,219 +1,325 @@
 package main
 
 import (
-	"errors"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
 	"log"
+	"os"
+	"os/signal"
 	"pfservice/config"
-	"pfservice/internal/area"
 	"pfservice/internal/db"
 	"pfservice/internal/httpclient"
 	media "pfservice/internal/media_download"
-	"pfservice/internal/property"
 	"pfservice/internal/reporting"
-	"pfservice/internal/users"
+	"strings"
+	"syscall"
+	"time"
 
 	"gorm.io/gorm"
 )
 
-func main() {
-	config.LoadConfig()
-	log.Println("PF SYNC STARTED...")
-
-	// Initialize statistics
-	stats := reporting.ReportStats{
-		Date: reporting.GetTashkentTime(),
-	}
+// watermarkOverlap is subtracted from the watermark so listings updated
+// around the start of the last run are fetched again despite clock skew
+const watermarkOverlap = 10 * time.Minute
 
-	dbConn := db.Connect()
+func main() {
+	// --sync is the default mode; the flag is kept for the cron entry
+	flag.Bool("sync", true, "sync listings from Property Finder (default)")
+	dryRunFlag := flag.Bool("dry-run", false, "print the planned writes as JSON without changing the database or media")
+	var pfIDs, references stringList
+	flag.Var(&pfIDs, "pf-id", "sync only the listing with this Property Finder ID (repeatable)")
+	flag.Var(&references, "reference", "sync only the listing with this reference (repeatable)")
+	fullFlag := flag.Bool("full", false, "fetch every listing instead of only those updated since the last run")
+	flag.Parse()
+
+	// A targeted run syncs only the requested listings and never hides any
+	targeted := len(pfIDs) > 0 || len(references) > 0
 
-	// Check for missing images (read-only check, no deletion)
-	log.Println("Checking existing images...")
-	missingImages, err := db.CheckMissingImages(dbConn)
-	if err != nil {
-		log.Printf("Warning: Failed to check missing images: %v", err)
-	} else if len(missingImages) > 0 {
-		log.Printf("Found %d missing images in database. Will attempt to re-download during sync...", len(missingImages))
-	} else {
-		log.Println("All existing images verified - no missing files found")
+	config.LoadConfig()
+	if err := media.ConfigureStorage(); err != nil {
+		log.Fatalf("Media storage error: %v", err)
 	}
-
-	token, err := httpclient.GetJWTToken()
+	retirePolicy, err := db.ParseRetirePolicy(config.AppConfig.ImageRetirePolicy)
 	if err != nil {
-		log.Fatal("Token error:", err)
+		log.Fatal("Config error:", err)
 	}
 
-	allPFUsers, err := httpclient.FetchAllUsers(token)
-	if err != nil {
-		log.Fatal("PF Users fetch error:", err)
+	if *dryRunFlag {
+		log.Println("PF SYNC DRY RUN STARTED...")
+	} else {
+		log.Println("PF SYNC STARTED...")
 	}
-
-	listResp, err := httpclient.FetchListings(token, 1)
-	if err != nil {
-		log.Fatal("PF Listings error:", err)
+	if targeted {
+		log.Printf("Targeted sync of %d listings", len(pfIDs)+len(references))
 	}
 
-	for _, listing := range listResp.Results {
-		log.Println("Processing:", listing.ID)
+	// Stop taking new work on SIGINT/SIGTERM; the listing in flight is finished
+	// and a partial report is written before exiting
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-		// FIND AGENT
-		var pfAgent *users.PFUser
-		for _, u := range allPFUsers {
-			if u.PublicProfile != nil && u.PublicProfile.ID == listing.AssignedTo.ID {
-				pfAgent = &u
-				break
-			}
+	dbConn := db.Connect()
+	if !*dryRunFlag {
+		if err := db.Migrate(ctx, dbConn); err != nil {
+			log.Fatal("DB migrate error:", err)
 		}
 
-		if pfAgent == nil {
-			log.Println("Agent not found:", listing.AssignedTo.ID)
-			continue
+		// Remove temp files left by downloads interrupted in an earlier run
+		swept, err := media.SweepTempFiles(media.TempFileMaxAge)
+		if err != nil {
+			log.Printf("Warning: Failed to sweep temp image files: %v", err)
+		} else if swept > 0 {
+			log.Printf("Removed %d orphaned temp image files", swept)
 		}
+	}
 
-		// SAVE USER
-		djUser := pfAgent.ToDjangoUser()
-
-		// Check if user exists before saving to track creation/update
-		var existingUser users.DjangoUser
-		userExists := dbConn.Where("email = ?", djUser.Email).First(&existingUser).Error == nil
-
-		savedUser, err := db.SaveOrUpdateUser(dbConn, djUser)
+	// Dry runs write nothing, not even their run record
+	var run *db.SyncRun
+	if !*dryRunFlag {
+		run, err = db.StartRun(ctx, dbConn, "pf_sync")
 		if err != nil {
-			log.Println("User save error:", err)
-			stats.Errors++
-			continue
+			log.Printf("Warning: Failed to record run: %v", err)
 		}
+	}
+	// fatal records the run as failed before exiting
+	fatal := func(msg string, err error) {
+		finishRun(ctx, dbConn, run, db.RunFailed, reporting.ReportStats{}, msg+" "+err.Error())
+		log.Fatal(msg, " ", err)
+	}
 
-		// Track user creation/update
-		if !userExists {
-			stats.UsersCreated++
+	// Check for missing images (read-only check, no deletion)
+	// A targeted run only checks the images of its own listings
+	if !targeted {
+		log.Println("Checking existing images...")
+		missingImages, err := db.CheckMissingImages(ctx, dbConn)
+		if err != nil {
+			log.Printf("Warning: Failed to check missing images: %v", err)
+		} else if len(missingImages) > 0 {
+			log.Printf("Found %d missing images in database. Will attempt to re-download during sync...", len(missingImages))
 		} else {
-			stats.UsersUpdated++
+			log.Println("All existing images verified - no missing files found")
 		}
+	}
 
-		userPointer := &savedUser.ID
-
-		// AREA
-		areaID := area.MapPFToDjangoArea(listing.Location.ID)
+	client := httpclient.NewClient(config.AppConfig)
+	if _, err := client.Token(ctx); err != nil {
+		fatal("Token error:", err)
+	}
 
-		// CREATE/UPDATE PROPERTY
-		prop := listing.ToDjangoProperty(userPointer, areaID)
+	allPFUsers, err := client.FetchAllUsers(ctx)
+	if err != nil {
+		fatal("PF Users fetch error:", err)
+	}
 
-		// Check if property exists before saving to track creation/update
-		var existingProp property.DjangoProperty
-		propExists := dbConn.Where("pf_id = ?", prop.PfID).First(&existingProp).Error == nil
+	// Targeted listings are fetched one by one instead of paging
+	var targets *targetSet
+	if targeted {
+		targets = fetchTargets(ctx, client, pfIDs, references)
+	}
 
-		savedProp, changed := db.SaveOrUpdateProperty(
-			dbConn,
-			prop,
-			listing.Title.En,
-			listing.Description.En,
-		)
+	// Between full syncs only listings updated since the last complete run are fetched
+	runStartedAt := time.Now().UTC()
+	account := syncAccount()
+	var since time.Time
+	full := !targeted
+	if !targeted && !*fullFlag {
+		state, err := db.GetSyncState(ctx, dbConn, account)
+		if err != nil {
+			log.Printf("Warning: %v, running a full sync", err)
+		} else if watermark, ok := state.IncrementalSince(config.AppConfig.FullSyncInterval, runStartedAt); ok {
+			since = watermark.Add(-watermarkOverlap)
+			full = false
+			log.Printf("Incremental sync of listings updated since %s", since.Format(time.RFC3339))
+		}
+	}
+	if full {
+		log.Println("Full sync of all listings")
+	}
 
-		// Track property creation/update
-		if !propExists {
-			stats.PropertiesCreated++
-		} else if changed {
-			stats.PropertiesUpdated++
+	if *dryRunFlag {
+		if err := dryRun(ctx, dbConn, client, allPFUsers, retirePolicy, targets, since); err != nil {
+			log.Fatal("Dry run error:", err)
 		}
+		log.Println("DRY RUN FINISHED, nothing was written")
+		return
+	}
 
-		// PROPERTY ID FOR IMAGES (uint, correct)
-		propIDuint := savedProp.ID
-
-		// Check existing images for this property and re-download missing ones
-		var existingImages []property.DjangoPropertyImage
-		dbConn.Where("property_id = ?", propIDuint).Find(&existingImages)
-		for _, existingImg := range existingImages {
-			if !media.ImageExists(existingImg.Image) {
-				log.Printf("Existing image missing for property %d: %s. Attempting to re-download...", propIDuint, existingImg.Image)
-				// Try to find matching URL in current listing and re-download
-				for imgIdx, listingImg := range listing.Media.Images {
-					if listingImg.Original.URL != "" {
-						localPath, err := media.DownloadImage(listingImg.Original.URL, propIDuint, imgIdx)
-						if err == nil && media.ImageExists(localPath) {
-							// Update existing record with new path instead of creating duplicate
-							existingImg.Image = localPath
-							err = dbConn.Save(&existingImg).Error
-							if err != nil {
-								log.Printf("Failed to update image record for property %d: %v", propIDuint, err)
-								stats.Errors++
-							} else {
-								log.Printf("Re-downloaded and updated missing image for property %d: %s", propIDuint, localPath)
-								stats.ImagesDownloaded++
-							}
-							break // Found and downloaded one image
-						}
-					}
-				}
+	var runID uint
+	if run != nil {
+		runID = run.ID
+	}
+	s := newSyncer(ctx, dbConn, allPFUsers, retirePolicy, runID)
+
+	// Images are downloaded by the pool while listings keep processing
+	imagesDone := make(chan struct{})
+	go func() {
+		s.collectImages(ctx)
+		close(imagesDone)
+	}()
+
+	// pf_ids returned by the API; visible properties not in here are hidden
+	// after a complete fetch
+	seen := make(map[string]bool)
+
+	var pager *httpclient.ListingPager
+	if targets != nil {
+		s.record(func(st *reporting.ReportStats) { st.Errors += len(targets.Failures) })
+		for _, listing := range targets.Listings {
+			if ctx.Err() != nil {
+				break
 			}
+			s.processListing(ctx, listing)
+		}
+	} else {
+		pager, err = syncAllListings(ctx, client, s, seen, since)
+		if err != nil {
+			fatal("PF Listings error:", err)
 		}
+	}
 
-		// SAVE NEW IMAGES
-		// Debug: Log media structure to understand API response
-		if len(listing.Media.Images) == 0 {
-			log.Printf("No images found in listing %s (pf_id: %s)", listing.ID, prop.PfID)
+	// Wait for queued image downloads to finish
+	s.pool.Close()
+	<-imagesDone
+
+	stats := s.stats
+	stats.Targeted = targeted
+	stats.Incremental = !targeted && !full
+	// problems is stored as the run's error summary
+	var problems []string
+	if ctx.Err() != nil {
+		stats.Interrupted = true
+		if pager != nil {
+			log.Printf("Received shutdown signal after page %d, writing partial report", pager.Page())
 		} else {
-			log.Printf("Found %d images in listing %s", len(listing.Media.Images), listing.ID)
+			log.Println("Received shutdown signal, writing partial report")
 		}
-
-		for idx, img := range listing.Media.Images {
-			url := img.Original.URL
-			if url == "" {
-				log.Printf("Empty URL for image %d in listing %s", idx, listing.ID)
-				continue
+	} else if targeted {
+		log.Println("Targeted run, withdrawn listings are not hidden")
+	} else if !pager.Complete() {
+		log.Printf("Warning: listings pagination stopped early after %d pages", pager.Page())
+		problems = append(problems, fmt.Sprintf("listings pagination stopped early after %d pages", pager.Page()))
+	} else if !full {
+		log.Printf("Fetched all %d pages of updated listings, withdrawn listings are hidden on the next full sync", pager.Page())
+		saveSyncState(ctx, dbConn, account, runStartedAt, false, s.listingsFailed)
+	} else {
+		log.Printf("Fetched all %d listing pages", pager.Page())
+		saveSyncState(ctx, dbConn, account, runStartedAt, true, s.listingsFailed)
+		hidden, err := db.HideMissingListings(ctx, dbConn, seen, config.AppConfig.HideMaxPercent, runID)
+		if err != nil {
+			log.Printf("Warning: Skipped hiding withdrawn listings: %v", err)
+			problems = append(problems, "skipped hiding withdrawn listings: "+err.Error())
+			stats.Errors++
+		} else if len(hidden) > 0 {
+			log.Printf("Hid %d properties no longer listed on Property Finder", len(hidden))
+			events := make([]db.SyncEvent, 0, len(hidden))
+			for _, pfID := range hidden {
+				events = append(events, db.SyncEvent{PfID: pfID, Action: db.EventHidden})
 			}
+			s.logEvents(ctx, events...)
+		}
+		stats.PropertiesHidden = len(hidden)
+	}
 
-			log.Printf("Downloading image %d for property %d: %s", idx+1, propIDuint, url)
+	// Write report
+	stats.Date = reporting.GetTashkentTime()
+	if err := reporting.WriteReport(stats); err != nil {
+		log.Printf("Warning: Failed to write report: %v", err)
+	}
 
-			// DownloadImage already has retry logic built-in
-			// It will retry up to IMAGE_DOWNLOAD_MAX_RETRIES times (default: 3)
-			// Pass image index to create unique filenames
-			localPath, err := media.DownloadImage(url, propIDuint, idx)
-			if err != nil {
-				log.Printf("Image download failed after retries for property %d, URL: %s, error: %v", propIDuint, url, err)
-				stats.Errors++
-				continue
-			}
+	if stats.Errors > 0 {
+		problems = append([]string{fmt.Sprintf("%d errors, see the log", stats.Errors)}, problems...)
+	}
+	status := db.CompletedStatus(stats.Errors)
+	if stats.Interrupted {
+		status = db.RunAborted
+	}
+	finishRun(ctx, dbConn, run, status, stats, strings.Join(problems, "; "))
 
-			// Verify image file actually exists before saving to database
-			if !media.ImageExists(localPath) {
-				log.Printf("Downloaded image file does not exist at %s, skipping database save", localPath)
-				continue
-			}
+	if stats.Interrupted {
+		log.Println("IMPORT INTERRUPTED")
+	} else if stats.Errors > 0 {
+		log.Println("IMPORT FINISHED WITH ERRORS")
+	} else {
+		log.Println("IMPORT FINISHED SUCCESSFULLY")
+	}
+	log.Printf("Summary: Created %d properties, Updated %d properties, Hidden %d properties, Downloaded %d images, Retired %d images, Created %d users, Updated %d users, Errors: %d",
+		stats.PropertiesCreated, stats.PropertiesUpdated, stats.PropertiesHidden, stats.ImagesDownloaded, stats.ImagesRetired, stats.UsersCreated, stats.UsersUpdated, stats.Errors)
+	if len(stats.PriceMovements) > 0 {
+		log.Printf("Price changed on %d properties, biggest movements:", len(stats.PriceMovements))
+		for _, m := range reporting.BiggestPriceMovements(stats.PriceMovements, 5) {
+			log.Printf("  %s (property %d): %d -> %d (%+.1f%%)", m.PfID, m.PropertyID, m.OldPrice, m.NewPrice, m.Percent())
+		}
+	}
+}
 
-			// Check if this image path already exists in database for this property
-			var existingImg property.DjangoPropertyImage
-			err = dbConn.Where("property_id = ? AND image = ?", propIDuint, localPath).First(&existingImg).Error
-			if err == nil {
-				// Image already exists in database, skip
-				continue
+// syncAllListings pages through every listing, or only those updated since
+// a non-zero since, and processes each one, recording the returned pf_ids in seen
+// An error means the first page could not be fetched.
+func syncAllListings(ctx context.Context, client *httpclient.Client, s *syncer, seen map[string]bool, since time.Time) (*httpclient.ListingPager, error) {
+	pager := client.NewListingPager()
+	pager.UpdatedSince = since
+	for ctx.Err() == nil {
+		listings, err := pager.Next(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
 			}
-			if !errors.Is(err, gorm.ErrRecordNotFound) {
-				// Some other error occurred, log and continue
-				log.Printf("Error checking existing image for property %d: %v", propIDuint, err)
-				continue
+			if pager.Page() == 0 {
+				return pager, err
 			}
+			log.Printf("PF Listings error on page %d, stopping pagination: %v", pager.Page()+1, err)
+			s.record(func(st *reporting.ReportStats) { st.Errors++ })
+			break
+		}
+		if listings == nil {
+			break
+		}
 
-			err = db.SavePropertyImage(dbConn, property.DjangoPropertyImage{
-				PropertyID: propIDuint,
-				Image:      localPath,
-			})
-			if err != nil {
-				log.Printf("Failed to save property image to database for property %d, path: %s, error: %v", propIDuint, localPath, err)
-				stats.Errors++
-				continue
-			}
+		log.Printf("Fetched listings page %d (%d listings)", pager.Page(), len(listings))
 
-			stats.ImagesDownloaded++
+		for _, listing := range listings {
+			if ctx.Err() != nil {
+				break
+			}
+			seen[listing.ID] = true
+			s.processListing(ctx, listing)
 		}
 	}
+	return pager, nil
+}
+
+// syncAccount identifies the Property Finder account the watermark belongs to
+// by a SHA-256 of its API key, so the key itself is never stored
+func syncAccount() string {
+	if config.AppConfig.PFAPIKey != "" {
+		sum := sha256.Sum256([]byte(config.AppConfig.PFAPIKey))
+		return "sha256:" + hex.EncodeToString(sum[:])
+	}
+	return "default"
+}
 
-	// Write report
-	stats.Date = reporting.GetTashkentTime()
-	if err := reporting.WriteReport(stats); err != nil {
-		log.Printf("Warning: Failed to write report: %v", err)
+// saveSyncState moves the watermark to the start of a complete run. A run
+// in which listings failed to save keeps the previous watermark so they are
+// fetched again by the next incremental run. Failed image downloads do not
+// hold it back; the next full sync picks them up.
+func saveSyncState(ctx context.Context, dbConn *gorm.DB, account string, startedAt time.Time, full bool, listingsFailed int) {
+	if listingsFailed > 0 {
+		log.Printf("Keeping the previous sync watermark, %d listings failed to save", listingsFailed)
+		return
+	}
+	// Not cancelled with ctx, the run is already complete
+	if err := db.SaveSyncState(context.WithoutCancel(ctx), dbConn, account, startedAt, full); err != nil {
+		log.Printf("Warning: Failed to save sync watermark: %v", err)
 	}
+}
 
-	log.Println("IMPORT FINISHED SUCCESSFULLY")
-	log.Printf("Summary: Created %d properties, Updated %d properties, Downloaded %d images, Created %d users, Updated %d users, Errors: %d",
-		stats.PropertiesCreated, stats.PropertiesUpdated, stats.ImagesDownloaded, stats.UsersCreated, stats.UsersUpdated, stats.Errors)
+// finishRun records the end of run, logging rather than failing on errors
+func finishRun(ctx context.Context, dbConn *gorm.DB, run *db.SyncRun, status db.RunStatus, stats reporting.ReportStats, errorSummary string) {
+	// Not cancelled with ctx so an aborted run is still recorded
+	if err := db.FinishRun(context.WithoutCancel(ctx), dbConn, run, status, stats, errorSummary); err != nil {
+		log.Printf("Warning: Failed to record run: %v", err)
+	}
 }
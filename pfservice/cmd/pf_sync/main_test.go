@@ -3,13 +3,18 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"image"
+	"image/jpeg"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"pfservice/config"
 	"pfservice/internal/area"
@@ -41,6 +46,10 @@ func setupTestSync(t *testing.T) (*gorm.DB, *httptest.Server, string) {
 		&property.DjangoProperty{},
 		&property.DjangoPropertyTranslation{},
 		&property.DjangoPropertyImage{},
+		&db.PropertyChange{},
+		&db.PriceHistory{},
+		&db.PriceState{},
+		&db.PropertyVisibility{},
 	)
 	if err != nil {
 		t.Fatalf("Failed to migrate test database: %v", err)
@@ -200,10 +209,17 @@ func handleMockListingsRequest(w http.ResponseWriter, r *http.Request) {
 }
 
 func handleMockImageRequest(w http.ResponseWriter, r *http.Request) {
-	jpegHeader := []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x10, 0x4A, 0x46, 0x49, 0x46}
+	jpegData := mockJPEG()
 	w.Header().Set("Content-Type", "image/jpeg")
 	w.WriteHeader(http.StatusOK)
-	w.Write(jpegHeader)
+	w.Write(jpegData)
+}
+
+// mockJPEG returns a small valid JPEG; the downloader rejects anything that is not a complete image
+func mockJPEG() []byte {
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 64, 48)), nil)
+	return buf.Bytes()
 }
 
 func TestSyncDoesNotDeleteDatabaseRecords(t *testing.T) {
@@ -221,7 +237,7 @@ func TestSyncDoesNotDeleteDatabaseRecords(t *testing.T) {
 		IsStaff:     false,
 		IsSuperuser: false,
 	}
-	savedUser, _ := db.SaveOrUpdateUser(testDB, user)
+	savedUser, _ := db.SaveOrUpdateUser(context.Background(), testDB, user)
 	userID := savedUser.ID
 
 	prop := property.DjangoProperty{
@@ -237,7 +253,8 @@ func TestSyncDoesNotDeleteDatabaseRecords(t *testing.T) {
 		Slug:             "test-listing-001",
 		IsVisible:        true,
 	}
-	savedProp, _ := db.SaveOrUpdateProperty(testDB, prop, "Test Property", "Test Description")
+	saved, _ := db.SaveListing(context.Background(), testDB, db.ListingWrite{Property: prop, Title: "Test Property", Description: "Test Description"})
+	savedProp := saved.Property
 
 	// Create existing image record in database
 	existingImage := property.DjangoPropertyImage{
@@ -267,9 +284,9 @@ func TestSyncDoesNotDeleteDatabaseRecords(t *testing.T) {
 		config.AppConfig = oldConfig
 	}()
 
-	token, _ := httpclient.GetJWTToken()
-	allPFUsers, _ := httpclient.FetchAllUsers(token)
-	listResp, _ := httpclient.FetchListings(token, 1)
+	client := httpclient.NewClient(config.AppConfig)
+	allPFUsers, _ := client.FetchAllUsers(context.Background())
+	listResp, _ := client.FetchListings(context.Background(), 1, 50)
 
 	for _, listing := range listResp.Results {
 		var pfAgent *users.PFUser
@@ -285,11 +302,12 @@ func TestSyncDoesNotDeleteDatabaseRecords(t *testing.T) {
 		}
 
 		djUser := pfAgent.ToDjangoUser()
-		savedUser, _ := db.SaveOrUpdateUser(testDB, djUser)
+		savedUser, _ := db.SaveOrUpdateUser(context.Background(), testDB, djUser)
 		userPointer := &savedUser.ID
 		areaID := area.MapPFToDjangoArea(listing.Location.ID)
 		prop := listing.ToDjangoProperty(userPointer, areaID)
-		savedProp, _ := db.SaveOrUpdateProperty(testDB, prop, listing.Title.En, listing.Description.En)
+		saved, _ := db.SaveListing(context.Background(), testDB, db.ListingWrite{Property: prop, Title: listing.Title.En, Description: listing.Description.En})
+		savedProp := saved.Property
 		propIDuint := savedProp.ID
 
 		// Download and save images
@@ -300,12 +318,12 @@ func TestSyncDoesNotDeleteDatabaseRecords(t *testing.T) {
 			}
 
 			fullURL := mockServer.URL + url
-			localPath, err := media.DownloadImage(fullURL, propIDuint, idx)
+			localPath, err := media.DownloadImage(context.Background(), fullURL, propIDuint, idx)
 			if err != nil {
 				continue
 			}
 
-			if !media.ImageExists(localPath) {
+			if !media.ImageExists(context.Background(), localPath) {
 				continue
 			}
 
@@ -358,7 +376,7 @@ func TestSyncImageExistenceCheck(t *testing.T) {
 		IsStaff:     false,
 		IsSuperuser: false,
 	}
-	savedUser, _ := db.SaveOrUpdateUser(testDB, user)
+	savedUser, _ := db.SaveOrUpdateUser(context.Background(), testDB, user)
 	userID := savedUser.ID
 
 	prop := property.DjangoProperty{
@@ -374,7 +392,8 @@ func TestSyncImageExistenceCheck(t *testing.T) {
 		Slug:             "test-listing-001",
 		IsVisible:        true,
 	}
-	savedProp, _ := db.SaveOrUpdateProperty(testDB, prop, "Test Property", "Test Description")
+	saved, _ := db.SaveListing(context.Background(), testDB, db.ListingWrite{Property: prop, Title: "Test Property", Description: "Test Description"})
+	savedProp := saved.Property
 
 	// Create image record pointing to non-existent file
 	missingImage := property.DjangoPropertyImage{
@@ -385,12 +404,12 @@ func TestSyncImageExistenceCheck(t *testing.T) {
 	missingImageID := missingImage.ID
 
 	// Verify file doesn't exist
-	if media.ImageExists(missingImage.Image) {
+	if media.ImageExists(context.Background(), missingImage.Image) {
 		t.Error("Test file should not exist")
 	}
 
 	// Check missing images
-	missingImages, err := db.CheckMissingImages(testDB)
+	missingImages, err := db.CheckMissingImages(context.Background(), testDB)
 	if err != nil {
 		t.Fatalf("Failed to check missing images: %v", err)
 	}
@@ -415,3 +434,59 @@ func TestSyncImageExistenceCheck(t *testing.T) {
 		t.Errorf("Image record was deleted during check! ID: %d", missingImageID)
 	}
 }
+
+func TestImageFailureDoesNotHoldBackWatermark(t *testing.T) {
+	testDB, mockServer, tmpMediaDir := setupTestSync(t)
+	defer mockServer.Close()
+	defer os.RemoveAll(tmpMediaDir)
+	t.Setenv("IMAGE_DOWNLOAD_MAX_RETRIES", "1")
+
+	ctx := context.Background()
+	if err := db.Migrate(ctx, testDB); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+	testDB.Exec("TRUNCATE TABLE pf_sync_state")
+
+	client := httpclient.NewClient(config.AppConfig)
+	allPFUsers, err := client.FetchAllUsers(ctx)
+	if err != nil {
+		t.Fatalf("Failed to fetch users: %v", err)
+	}
+	listResp, err := client.FetchListings(ctx, 1, 50)
+	if err != nil {
+		t.Fatalf("Failed to fetch listings: %v", err)
+	}
+
+	// The second image is gone on the CDN
+	listing := listResp.Results[0]
+	listing.Media.Images[0].Original.URL = mockServer.URL + "/test-image-1.jpg"
+	listing.Media.Images[1].Original.URL = mockServer.URL + "/missing-image.gif"
+
+	s := newSyncer(ctx, testDB, allPFUsers, db.RetireKeep, 0)
+	imagesDone := make(chan struct{})
+	go func() {
+		s.collectImages(ctx)
+		close(imagesDone)
+	}()
+	s.processListing(ctx, listing)
+	s.pool.Close()
+	<-imagesDone
+
+	if s.stats.Errors != 1 {
+		t.Errorf("Expected the failed image counted as 1 error, got %d", s.stats.Errors)
+	}
+	if s.listingsFailed != 0 {
+		t.Fatalf("Expected the listing itself to be saved, %d listings failed", s.listingsFailed)
+	}
+
+	startedAt := time.Now().UTC().Truncate(time.Microsecond)
+	saveSyncState(ctx, testDB, "test-account", startedAt, false, s.listingsFailed)
+
+	state, err := db.GetSyncState(ctx, testDB, "test-account")
+	if err != nil {
+		t.Fatalf("Failed to load sync state: %v", err)
+	}
+	if state.LastSyncedAt == nil || !state.LastSyncedAt.Equal(startedAt) {
+		t.Errorf("Expected the watermark to move to %v despite the image failure, got %v", startedAt, state.LastSyncedAt)
+	}
+}
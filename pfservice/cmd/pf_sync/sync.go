@@ -0,0 +1,423 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"pfservice/internal/area"
+	"pfservice/internal/db"
+	media "pfservice/internal/media_download"
+	"pfservice/internal/property"
+	"pfservice/internal/reporting"
+	"pfservice/internal/users"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// syncer holds the state shared by the listing loop and the image collector
+type syncer struct {
+	db     *gorm.DB
+	users  []users.PFUser
+	pool   *media.Pool
+	retire db.RetirePolicy
+	// runID links the events of this run to its pf_sync_runs row
+	runID uint
+
+	mu    sync.Mutex
+	stats reporting.ReportStats
+	// listingsFailed counts listings whose database write failed; unlike
+	// image failures these hold the sync watermark back
+	listingsFailed int
+	// pending holds listings waiting for their image downloads, by job key
+	pending map[string]*pendingListing
+	seq     int
+}
+
+func newSyncer(ctx context.Context, dbConn *gorm.DB, allPFUsers []users.PFUser, retire db.RetirePolicy, runID uint) *syncer {
+	return &syncer{
+		db:      dbConn,
+		users:   allPFUsers,
+		retire:  retire,
+		runID:   runID,
+		pool:    media.NewPool(ctx, media.PoolOptions{}),
+		pending: make(map[string]*pendingListing),
+		stats: reporting.ReportStats{
+			Date: reporting.GetTashkentTime(),
+		},
+	}
+}
+
+// record updates the run statistics; it is safe to call from any goroutine
+func (s *syncer) record(update func(st *reporting.ReportStats)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	update(&s.stats)
+}
+
+// failListing counts a listing whose database write failed
+func (s *syncer) failListing() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.Errors++
+	s.listingsFailed++
+}
+
+// logEvents records what the run did to listings in pf_sync_events.
+// A failure is only logged; the sync itself goes on.
+func (s *syncer) logEvents(ctx context.Context, events ...db.SyncEvent) {
+	for i := range events {
+		events[i].RunID = s.runID
+	}
+	// Not cancelled with ctx so events of the listing in flight are kept
+	if err := db.RecordEvents(context.WithoutCancel(ctx), s.db, events); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+}
+
+// processListing saves the agent for one listing and queues its images on the
+// download pool. The property, translation and images are committed together
+// by commitListing once the downloads finish.
+// Database writes are not cancelled with ctx so a listing in flight during
+// shutdown is finished; image downloads stop as soon as ctx is cancelled.
+func (s *syncer) processListing(ctx context.Context, listing property.PFListing) {
+	log.Println("Processing:", listing.ID)
+
+	dbCtx := context.WithoutCancel(ctx)
+	dbConn := s.db.WithContext(dbCtx)
+
+	// FIND AGENT
+	pfAgent := findAgent(s.users, listing.AssignedTo.ID)
+	if pfAgent == nil {
+		log.Println("Agent not found:", listing.AssignedTo.ID)
+		s.logEvents(ctx, db.SyncEvent{
+			PfID:   listing.ID,
+			Action: db.EventAgentMissing,
+			Error:  fmt.Sprintf("agent %d not found", listing.AssignedTo.ID),
+		})
+		return
+	}
+
+	// SAVE USER
+	djUser := pfAgent.ToDjangoUser()
+
+	// Check if user exists before saving to track creation/update
+	var existingUser users.DjangoUser
+	userExists := dbConn.Where("email = ?", djUser.Email).First(&existingUser).Error == nil
+
+	savedUser, err := db.SaveOrUpdateUser(dbCtx, dbConn, djUser)
+	if err != nil {
+		log.Println("User save error:", err)
+		s.failListing()
+		s.logEvents(ctx, db.SyncEvent{PfID: listing.ID, Action: db.EventFailed, Error: "save agent: " + err.Error()})
+		return
+	}
+
+	// Track user creation/update
+	s.record(func(st *reporting.ReportStats) {
+		if !userExists {
+			st.UsersCreated++
+		} else {
+			st.UsersUpdated++
+		}
+	})
+
+	userPointer := &savedUser.ID
+
+	// AREA
+	areaID := area.MapPFToDjangoArea(listing.Location.ID)
+
+	// CREATE/UPDATE PROPERTY
+	prop := listing.ToDjangoProperty(userPointer, areaID)
+
+	// The property is written together with its images once they are downloaded
+	p := &pendingListing{
+		key: fmt.Sprintf("%s/%d", listing.ID, s.nextSeq()),
+		write: db.ListingWrite{
+			Property:       prop,
+			Title:          listing.Title.En,
+			Description:    listing.Description.En,
+			NewImages:      make([]db.ImageWrite, len(listing.Media.Images)),
+			RelinkedImages: make(map[uint]db.ImageWrite),
+		},
+	}
+	s.mu.Lock()
+	s.pending[p.key] = p
+	s.mu.Unlock()
+
+	// PROPERTY ID FOR IMAGES (uint, correct; 0 for a new property)
+	var existingProp property.DjangoProperty
+	propIDuint := uint(0)
+	if dbConn.Where("pf_id = ?", prop.PfID).First(&existingProp).Error == nil {
+		propIDuint = existingProp.ID
+	}
+
+	// URLs already queued for this listing; a URL is downloaded once
+	queued := make(map[string]bool)
+	submitted := 0
+
+	imageURLs := make([]string, len(listing.Media.Images))
+	for idx, img := range listing.Media.Images {
+		imageURLs[idx] = img.Original.URL
+	}
+	p.write.ImageURLs = imageURLs
+	p.write.RetirePolicy = s.retire
+	p.write.RunID = s.runID
+
+	// Check existing images for this property and re-download missing ones
+	stored, err := loadStoredImages(dbCtx, dbConn, propIDuint, imageURLs)
+	if err != nil {
+		log.Printf("Failed to load images for property %d: %v", propIDuint, err)
+	}
+	p.write.KnownHashes = stored.hashes
+
+	for _, missing := range stored.missing {
+		// Re-download exactly the image this record was created from
+		if missing.index < 0 {
+			log.Printf("Existing image missing for property %d: %s. No matching image in listing, skipping re-download", propIDuint, missing.image.Image)
+			continue
+		}
+
+		url := imageURLs[missing.index]
+		if queued[url] {
+			continue
+		}
+		log.Printf("Existing image missing for property %d: %s. Queueing re-download...", propIDuint, missing.image.Image)
+		queued[url] = s.pool.Submit(media.ImageJob{
+			URL:        url,
+			PropertyID: propIDuint,
+			Index:      missing.index,
+			Key:        p.key,
+			ImageID:    missing.image.ID,
+		})
+		if queued[url] {
+			submitted++
+		}
+	}
+
+	// SAVE NEW IMAGES
+	// Debug: Log media structure to understand API response
+	if len(listing.Media.Images) == 0 {
+		log.Printf("No images found in listing %s (pf_id: %s)", listing.ID, prop.PfID)
+	} else {
+		log.Printf("Found %d images in listing %s", len(listing.Media.Images), listing.ID)
+	}
+
+	for idx, img := range listing.Media.Images {
+		url := img.Original.URL
+		if url == "" {
+			log.Printf("Empty URL for image %d in listing %s", idx, listing.ID)
+			continue
+		}
+		if queued[url] || stored.present[idx] {
+			continue
+		}
+
+		// The pool retries up to IMAGE_DOWNLOAD_MAX_RETRIES times (default: 3)
+		if !s.pool.Submit(media.ImageJob{
+			URL:        url,
+			PropertyID: propIDuint,
+			Index:      idx,
+			Key:        p.key,
+		}) {
+			log.Printf("Shutdown requested, skipping remaining images for listing %s", listing.ID)
+			break
+		}
+		submitted++
+	}
+
+	// Commit now if every download already finished (or none was queued)
+	s.mu.Lock()
+	p.expected = submitted
+	p.sealed = true
+	ready := s.takeIfReady(p)
+	s.mu.Unlock()
+
+	if ready {
+		s.commitListing(ctx, p)
+	}
+}
+
+// findAgent returns the user whose public profile has the given ID, or nil
+func findAgent(allPFUsers []users.PFUser, profileID int64) *users.PFUser {
+	for i, u := range allPFUsers {
+		if u.PublicProfile != nil && u.PublicProfile.ID == profileID {
+			return &allPFUsers[i]
+		}
+	}
+	return nil
+}
+
+// pendingListing is a listing whose images are still downloading
+type pendingListing struct {
+	key      string
+	write    db.ListingWrite
+	expected int
+	received int
+	// sealed is set once all of the listing's downloads have been queued
+	sealed bool
+}
+
+// nextSeq returns a sequence number that keeps pending keys unique
+// when the API returns the same listing twice
+func (s *syncer) nextSeq() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	return s.seq
+}
+
+// takeIfReady removes p from the pending set once all its downloads are in.
+// It must be called with s.mu held.
+func (s *syncer) takeIfReady(p *pendingListing) bool {
+	if !p.sealed || p.received < p.expected {
+		return false
+	}
+	if _, ok := s.pending[p.key]; !ok {
+		return false
+	}
+	delete(s.pending, p.key)
+	return true
+}
+
+// commitListing writes the property, translation and downloaded images of one
+// listing in a single transaction. A failure rolls back only this listing.
+func (s *syncer) commitListing(ctx context.Context, p *pendingListing) {
+	// Not cancelled with ctx so the listing in flight is finished on shutdown
+	dbCtx := context.WithoutCancel(ctx)
+
+	// Keep the listing's image order and drop images that failed to download
+	newImages := make([]db.ImageWrite, 0, len(p.write.NewImages))
+	for _, img := range p.write.NewImages {
+		if img.Path != "" {
+			newImages = append(newImages, img)
+		}
+	}
+	p.write.NewImages = newImages
+
+	result, err := db.SaveListing(dbCtx, s.db, p.write)
+	if err != nil {
+		log.Printf("Failed to save listing %s, rolled back: %v", p.write.Property.PfID, err)
+		s.failListing()
+		s.logEvents(ctx, db.SyncEvent{PfID: p.write.Property.PfID, Action: db.EventFailed, Error: err.Error()})
+		return
+	}
+
+	pfID, propertyID := p.write.Property.PfID, result.Property.ID
+	var events []db.SyncEvent
+	if result.Created {
+		events = append(events, db.SyncEvent{PfID: pfID, PropertyID: propertyID, Action: db.EventCreated})
+	} else if result.Changed {
+		events = append(events, db.SyncEvent{PfID: pfID, PropertyID: propertyID, Action: db.EventUpdated})
+	}
+	for _, img := range p.write.NewImages {
+		events = append(events, db.SyncEvent{PfID: pfID, PropertyID: propertyID, Action: db.EventImageAdded, Detail: img.Path})
+	}
+	for _, img := range p.write.RelinkedImages {
+		events = append(events, db.SyncEvent{PfID: pfID, PropertyID: propertyID, Action: db.EventImageAdded, Detail: img.Path})
+	}
+
+	for _, img := range p.write.RelinkedImages {
+		log.Printf("Re-downloaded and updated missing image for property %d: %s", result.Property.ID, img.Path)
+	}
+	// Files are moved only after the commit; a flagged image, or a file
+	// shared with another active image, stays in place
+	for _, img := range result.Retired {
+		removed := db.SyncEvent{PfID: pfID, PropertyID: propertyID, Action: db.EventImageRemoved, Detail: img.Path}
+		if img.Flagged {
+			log.Printf("Flagged image %d for property %d as retired, file %s is kept", img.ImageID, result.Property.ID, img.Path)
+			events = append(events, removed)
+			continue
+		}
+		if img.Shared {
+			log.Printf("Retired image %d for property %d, file %s is still in use", img.ImageID, result.Property.ID, img.Path)
+			events = append(events, removed)
+			continue
+		}
+		dst, err := media.QuarantineImage(dbCtx, img.Path)
+		if err != nil {
+			log.Printf("Retired image %d for property %d, failed to quarantine %s: %v", img.ImageID, result.Property.ID, img.Path, err)
+			s.record(func(st *reporting.ReportStats) { st.Errors++ })
+			removed.Error = "quarantine file: " + err.Error()
+			events = append(events, removed)
+			continue
+		}
+		log.Printf("Retired image %d for property %d, moved %s to %s", img.ImageID, result.Property.ID, img.Path, dst)
+		events = append(events, removed)
+	}
+	s.logEvents(ctx, events...)
+
+	if result.ImagesReordered > 0 {
+		log.Printf("Reordered %d images for property %d to match Property Finder", result.ImagesReordered, result.Property.ID)
+	}
+
+	// Track property creation/update
+	s.record(func(st *reporting.ReportStats) {
+		if result.Created {
+			st.PropertiesCreated++
+		} else if result.Changed {
+			st.PropertiesUpdated++
+		}
+		st.ImagesDownloaded += result.ImagesAdded + result.ImagesRelinked
+		st.ImagesRetired += len(result.Retired)
+		if result.PriceMovement != nil {
+			st.PriceMovements = append(st.PriceMovements, *result.PriceMovement)
+		}
+	})
+}
+
+// collectImages attaches finished downloads to their pending listing and
+// commits each listing once its last download is in, until the pool is closed
+func (s *syncer) collectImages(ctx context.Context) {
+	// Finished downloads are still committed after shutdown is requested
+	storeCtx := context.WithoutCancel(ctx)
+
+	for res := range s.pool.Results() {
+		job := res.Job
+
+		// Verify image file actually exists before saving to database;
+		// checked outside the lock as it is a round-trip on S3
+		stored := false
+		if res.Err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Image download failed after retries for property %d, URL: %s, error: %v", job.PropertyID, job.URL, res.Err)
+				s.record(func(st *reporting.ReportStats) { st.Errors++ })
+			}
+		} else if stored = media.ImageExists(storeCtx, res.Path); !stored {
+			log.Printf("Downloaded image file does not exist at %s, skipping database save", res.Path)
+		}
+
+		s.mu.Lock()
+		p, ok := s.pending[job.Key]
+		ready := false
+		pfID := ""
+		if ok {
+			pfID = p.write.Property.PfID
+			if stored {
+				img := db.ImageWrite{Path: res.Path, SourceURL: job.URL, ContentHash: res.Hash}
+				if job.ImageID != 0 {
+					p.write.RelinkedImages[job.ImageID] = img
+				} else {
+					p.write.NewImages[job.Index] = img
+				}
+			}
+			p.received++
+			ready = s.takeIfReady(p)
+		}
+		s.mu.Unlock()
+
+		if ok && res.Err != nil && ctx.Err() == nil {
+			s.logEvents(ctx, db.SyncEvent{
+				PfID:       pfID,
+				PropertyID: job.PropertyID,
+				Action:     db.EventImageFailed,
+				Detail:     job.URL,
+				Error:      res.Err.Error(),
+			})
+		}
+
+		if ready {
+			s.commitListing(ctx, p)
+		}
+	}
+}
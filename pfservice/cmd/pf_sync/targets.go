@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"log"
+	"pfservice/internal/httpclient"
+	"pfservice/internal/property"
+	"strings"
+)
+
+// stringList is a flag that can be given more than once
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// targetSet holds the listings of a targeted run, fetched one by one
+type targetSet struct {
+	Listings []property.PFListing
+	// Failures are the requested pf_ids and references that could not be fetched
+	Failures []targetFailure
+}
+
+type targetFailure struct {
+	Key string
+	Err error
+}
+
+// fetchTargets fetches the listings selected by --pf-id and --reference.
+// A listing requested both ways is returned once.
+func fetchTargets(ctx context.Context, client *httpclient.Client, pfIDs, references []string) *targetSet {
+	targets := &targetSet{}
+	seen := make(map[string]bool)
+
+	add := func(key string, listing *property.PFListing, err error) {
+		if err != nil {
+			log.Printf("Failed to fetch listing %s: %v", key, err)
+			targets.Failures = append(targets.Failures, targetFailure{Key: key, Err: err})
+			return
+		}
+		if seen[listing.ID] {
+			return
+		}
+		seen[listing.ID] = true
+		targets.Listings = append(targets.Listings, *listing)
+	}
+
+	for _, pfID := range pfIDs {
+		if ctx.Err() != nil {
+			return targets
+		}
+		listing, err := client.FetchListing(ctx, pfID)
+		add(pfID, listing, err)
+	}
+	for _, reference := range references {
+		if ctx.Err() != nil {
+			return targets
+		}
+		listing, err := client.FetchListingByReference(ctx, reference)
+		add(reference, listing, err)
+	}
+
+	log.Printf("Fetched %d of %d targeted listings", len(targets.Listings), len(pfIDs)+len(references))
+	return targets
+}
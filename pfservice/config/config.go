@@ -2,6 +2,8 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -11,6 +13,27 @@ type Config struct {
 	PFAPIKey    string
 	PFAPISecret string
 	PostgresDSN string
+
+	// API client behaviour
+	PFAPITimeout       time.Duration
+	PFAPIMaxRetries    int
+	PFAPIRetryDelay    time.Duration
+	PFAPIRetryMaxDelay time.Duration
+
+	// Listings pagination
+	ListingsPageSize int
+	ListingsMaxPages int
+
+	// Largest share of visible properties pf_sync may hide in one run, in percent
+	HideMaxPercent int
+
+	// What pf_sync does with images removed from a listing: keep, flag
+	// (record retired_at only, the site still shows them) or remove
+	ImageRetirePolicy string
+
+	// How often pf_sync runs a full sync instead of an incremental one;
+	// 0 makes every run a full sync
+	FullSyncInterval time.Duration
 }
 
 var AppConfig *Config
@@ -19,10 +42,19 @@ func LoadConfig() {
 	_ = godotenv.Load()
 
 	AppConfig = &Config{
-		PFAPIUrl:    getEnv("PF_API_URL", ""),
-		PFAPIKey:    getEnv("PF_API_KEY", ""),
-		PFAPISecret: getEnv("PF_API_SECRET", ""),
-		PostgresDSN: getEnv("POSTGRES_DSN", ""),
+		PFAPIUrl:           getEnv("PF_API_URL", ""),
+		PFAPIKey:           getEnv("PF_API_KEY", ""),
+		PFAPISecret:        getEnv("PF_API_SECRET", ""),
+		PostgresDSN:        getEnv("POSTGRES_DSN", ""),
+		PFAPITimeout:       getEnvSeconds("PF_API_TIMEOUT", 30*time.Second),
+		PFAPIMaxRetries:    getEnvInt("PF_API_MAX_RETRIES", 3),
+		PFAPIRetryDelay:    getEnvSeconds("PF_API_RETRY_DELAY", 1*time.Second),
+		PFAPIRetryMaxDelay: getEnvSeconds("PF_API_RETRY_MAX_DELAY", 30*time.Second),
+		ListingsPageSize:   getEnvInt("PF_LISTINGS_PAGE_SIZE", 50),
+		ListingsMaxPages:   getEnvInt("PF_LISTINGS_MAX_PAGES", 100),
+		HideMaxPercent:     getEnvInt("PF_HIDE_MAX_PERCENT", 10),
+		ImageRetirePolicy:  getEnv("PF_IMAGE_RETIRE_POLICY", "keep"),
+		FullSyncInterval:   time.Duration(getEnvInt("PF_FULL_SYNC_HOURS", 168)) * time.Hour,
 	}
 }
 
@@ -32,3 +64,22 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+func getEnvInt(key string, fallback int) int {
+	if value, exists := os.LookupEnv(key); exists {
+		if i, err := strconv.Atoi(value); err == nil {
+			return i
+		}
+	}
+	return fallback
+}
+
+// getEnvSeconds reads a whole number of seconds from the environment
+func getEnvSeconds(key string, fallback time.Duration) time.Duration {
+	if value, exists := os.LookupEnv(key); exists {
+		if i, err := strconv.Atoi(value); err == nil && i >= 0 {
+			return time.Duration(i) * time.Second
+		}
+	}
+	return fallback
+}
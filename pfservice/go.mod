@@ -5,12 +5,12 @@ go 1.23.0
 require (
 	github.com/go-resty/resty/v2 v2.17.0
 	github.com/joho/godotenv v1.5.1
+	golang.org/x/image v0.30.0
 	gorm.io/driver/postgres v1.6.0
 	gorm.io/gorm v1.31.1
 )
 
 require (
-	github.com/google/uuid v1.6.0 // indirect
 	github.com/jackc/pgpassfile v1.0.0 // indirect
 	github.com/jackc/pgservicefile v0.0.0-20240606120523-5a60cdf6a761 // indirect
 	github.com/jackc/pgx/v5 v5.6.0 // indirect
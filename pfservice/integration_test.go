@@ -1,7 +1,11 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"image"
+	"image/jpeg"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -38,6 +42,9 @@ func setupIntegrationTest(t *testing.T) (*gorm.DB, *httptest.Server, string) {
 		&property.DjangoProperty{},
 		&property.DjangoPropertyTranslation{},
 		&property.DjangoPropertyImage{},
+		&db.PropertyChange{},
+		&db.PriceHistory{},
+		&db.PriceState{},
 	)
 	if err != nil {
 		t.Fatalf("Failed to migrate test database: %v", err)
@@ -303,11 +310,17 @@ func handleListingsRequest(w http.ResponseWriter, r *http.Request) {
 }
 
 func handleImageRequest(w http.ResponseWriter, r *http.Request) {
-	// Return a mock JPEG image
-	jpegHeader := []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x10, 0x4A, 0x46, 0x49, 0x46}
+	jpegData := mockJPEG()
 	w.Header().Set("Content-Type", "image/jpeg")
 	w.WriteHeader(http.StatusOK)
-	w.Write(jpegHeader)
+	w.Write(jpegData)
+}
+
+// mockJPEG returns a small valid JPEG; the downloader rejects anything that is not a complete image
+func mockJPEG() []byte {
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 64, 48)), nil)
+	return buf.Bytes()
 }
 
 func TestIntegrationSyncFlow(t *testing.T) {
@@ -316,16 +329,17 @@ func TestIntegrationSyncFlow(t *testing.T) {
 	defer os.RemoveAll(tmpMediaDir)
 
 	// Get JWT token
-	token, err := httpclient.GetJWTToken()
+	client := httpclient.NewClient(config.AppConfig)
+	token, err := client.RequestToken(context.Background())
 	if err != nil {
 		t.Fatalf("Failed to get JWT token: %v", err)
 	}
-	if token != "mock-jwt-token-12345" {
-		t.Errorf("Expected token 'mock-jwt-token-12345', got '%s'", token)
+	if token.AccessToken != "mock-jwt-token-12345" {
+		t.Errorf("Expected token 'mock-jwt-token-12345', got '%s'", token.AccessToken)
 	}
 
 	// Fetch users
-	allPFUsers, err := httpclient.FetchAllUsers(token)
+	allPFUsers, err := client.FetchAllUsers(context.Background())
 	if err != nil {
 		t.Fatalf("Failed to fetch users: %v", err)
 	}
@@ -334,7 +348,7 @@ func TestIntegrationSyncFlow(t *testing.T) {
 	}
 
 	// Fetch listings
-	listResp, err := httpclient.FetchListings(token, 1)
+	listResp, err := client.FetchListings(context.Background(), 1, 50)
 	if err != nil {
 		t.Fatalf("Failed to fetch listings: %v", err)
 	}
@@ -360,7 +374,7 @@ func TestIntegrationSyncFlow(t *testing.T) {
 
 		// Save user
 		djUser := pfAgent.ToDjangoUser()
-		savedUser, err := db.SaveOrUpdateUser(testDB, djUser)
+		savedUser, err := db.SaveOrUpdateUser(context.Background(), testDB, djUser)
 		if err != nil {
 			t.Fatalf("Failed to save user: %v", err)
 		}
@@ -375,12 +389,12 @@ func TestIntegrationSyncFlow(t *testing.T) {
 
 		// Create/update property
 		prop := listing.ToDjangoProperty(userPointer, areaID)
-		savedProp, _ := db.SaveOrUpdateProperty(
-			testDB,
-			prop,
-			listing.Title.En,
-			listing.Description.En,
-		)
+		saved, _ := db.SaveListing(context.Background(), testDB, db.ListingWrite{
+			Property:    prop,
+			Title:       listing.Title.En,
+			Description: listing.Description.En,
+		})
+		savedProp := saved.Property
 
 		if savedProp.ID == 0 {
 			t.Error("Property ID should be set after save")
@@ -410,16 +424,16 @@ func TestIntegrationSyncFlow(t *testing.T) {
 
 			// Make full URL for mock server
 			fullURL := mockServer.URL + url
-			localPath, err := media.DownloadImage(fullURL, propIDuint, imageCount)
+			localPath, err := media.DownloadImage(context.Background(), fullURL, propIDuint, imageCount)
 			if err != nil {
 				t.Logf("Image download error (may be expected in test): %v", err)
 				continue
 			}
 
-			err = db.SavePropertyImage(testDB, property.DjangoPropertyImage{
+			err = testDB.Create(&property.DjangoPropertyImage{
 				PropertyID: propIDuint,
 				Image:      localPath,
-			})
+			}).Error
 			if err != nil {
 				t.Fatalf("Failed to save property image: %v", err)
 			}
@@ -504,14 +518,14 @@ func TestIntegrationMediaPathConfiguration(t *testing.T) {
 
 	// Create a mock server for image download
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		jpegHeader := []byte{0xFF, 0xD8, 0xFF, 0xE0}
+		jpegData := mockJPEG()
 		w.Header().Set("Content-Type", "image/jpeg")
 		w.WriteHeader(http.StatusOK)
-		w.Write(jpegHeader)
+		w.Write(jpegData)
 	}))
 	defer server.Close()
 
-	localPath, err := media.DownloadImage(server.URL+"/test.jpg", 123, 0)
+	localPath, err := media.DownloadImage(context.Background(), server.URL+"/test.jpg", 123, 0)
 	if err != nil {
 		t.Fatalf("Failed to download image: %v", err)
 	}
@@ -1,10 +1,11 @@
 package db
 
 import (
-	"os"
-	"path/filepath"
+	"context"
+	"fmt"
 	media "pfservice/internal/media_download"
 	"pfservice/internal/property"
+	"sort"
 
 	"gorm.io/gorm"
 )
@@ -17,67 +18,97 @@ type MissingImageInfo struct {
 	ImagePath  string
 }
 
-// CheckMissingImages scans all property images in the database and checks if files exist
-// Returns a list of missing images
-func CheckMissingImages(db *gorm.DB) ([]MissingImageInfo, error) {
-	var allImages []property.DjangoPropertyImage
-	err := db.Find(&allImages).Error
-	if err != nil {
-		return nil, err
+// CheckMissingImages checks every active image record's file and returns the
+// missing ones, ordered by image ID. See ScanImages to stream the results.
+func CheckMissingImages(ctx context.Context, db *gorm.DB) ([]MissingImageInfo, error) {
+	var missingImages []MissingImageInfo
+	var scanErr error
+
+	for check := range ScanImages(ctx, db) {
+		if check.Err != nil {
+			scanErr = check.Err
+			continue
+		}
+		if !check.Exists {
+			missingImages = append(missingImages, check.Image)
+		}
 	}
 
-	var missingImages []MissingImageInfo
+	sort.Slice(missingImages, func(i, j int) bool {
+		return missingImages[i].ImageID < missingImages[j].ImageID
+	})
+	return missingImages, scanErr
+}
+
+// MissingVariantInfo is a present image with one or more resized variants missing
+type MissingVariantInfo struct {
+	ImageID    uint
+	PropertyID uint
+	PfID       string
+	ImagePath  string
+	// Variants are the names of the missing variants
+	Variants []string
+}
+
+// CheckMissingVariants scans all property images whose original file exists
+// and returns those missing any of the configured media.Variants
+func CheckMissingVariants(ctx context.Context, db *gorm.DB) ([]MissingVariantInfo, error) {
+	if len(media.Variants) == 0 {
+		return nil, nil
+	}
 
-	for _, img := range allImages {
-		// Get full path to image file
-		fullPath := filepath.Join(media.MediaRoot, img.Image)
+	var missingVariants []MissingVariantInfo
 
-		// Check if file exists
-		if _, err := os.Stat(fullPath); os.IsNotExist(err) {
-			// File doesn't exist, get property info to find pf_id
-			var prop property.DjangoProperty
-			err := db.Where("id = ?", img.PropertyID).First(&prop).Error
+	err := eachImageBatch(ctx, db, func(batch []imageRow) error {
+		for _, row := range batch {
+			// Missing originals are reported by CheckMissingImages
+			exists, err := media.Store.Exists(ctx, row.Image)
 			if err != nil {
-				// Property not found, skip
+				return fmt.Errorf("check image %s: %w", row.Image, err)
+			}
+			if !exists {
 				continue
 			}
 
-			missingImages = append(missingImages, MissingImageInfo{
-				ImageID:    img.ID,
-				PropertyID: img.PropertyID,
-				PfID:       prop.PfID,
-				ImagePath:  img.Image,
+			missing, err := media.MissingVariants(ctx, row.Image)
+			if err != nil {
+				return fmt.Errorf("check variants of %s: %w", row.Image, err)
+			}
+			if len(missing) == 0 {
+				continue
+			}
+
+			names := make([]string, len(missing))
+			for i, v := range missing {
+				names[i] = v.Name
+			}
+			missingVariants = append(missingVariants, MissingVariantInfo{
+				ImageID:    row.ImageID,
+				PropertyID: row.PropertyID,
+				PfID:       row.PfID,
+				ImagePath:  row.Image,
+				Variants:   names,
 			})
 		}
-	}
+		return nil
+	})
 
-	return missingImages, nil
+	return missingVariants, err
 }
 
-// GetAllPropertyImages returns all property images grouped by property ID
-func GetAllPropertyImages(db *gorm.DB) (map[uint][]property.DjangoPropertyImage, error) {
-	var allImages []property.DjangoPropertyImage
-	err := db.Find(&allImages).Error
-	if err != nil {
+// ReferencedImagePaths returns the image path of every property image record,
+// retired ones included
+func ReferencedImagePaths(ctx context.Context, db *gorm.DB) (map[string]bool, error) {
+	var paths []string
+	if err := db.WithContext(ctx).Model(&property.DjangoPropertyImage{}).Pluck("image", &paths).Error; err != nil {
 		return nil, err
 	}
 
-	imagesByProperty := make(map[uint][]property.DjangoPropertyImage)
-	for _, img := range allImages {
-		imagesByProperty[img.PropertyID] = append(imagesByProperty[img.PropertyID], img)
+	referenced := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		if p != "" {
+			referenced[p] = true
+		}
 	}
-
-	return imagesByProperty, nil
-}
-
-// GetPropertiesByPfIDs fetches properties by their PF IDs
-func GetPropertiesByPfIDs(db *gorm.DB, pfIDs []string) ([]property.DjangoProperty, error) {
-	var properties []property.DjangoProperty
-	err := db.Where("pf_id IN ?", pfIDs).Find(&properties).Error
-	return properties, err
-}
-
-// DeletePropertyImage deletes an image record from the database
-func DeletePropertyImage(db *gorm.DB, imageID uint) error {
-	return db.Delete(&property.DjangoPropertyImage{}, imageID).Error
+	return referenced, nil
 }
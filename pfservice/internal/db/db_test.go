@@ -1,10 +1,15 @@
 package db
 
 import (
+	"context"
+	"errors"
 	"os"
+	media "pfservice/internal/media_download"
 	"pfservice/internal/property"
+	"pfservice/internal/reporting"
 	"pfservice/internal/users"
 	"testing"
+	"time"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -27,13 +32,20 @@ func setupTestDB(t *testing.T) *gorm.DB {
 		&property.DjangoProperty{},
 		&property.DjangoPropertyTranslation{},
 		&property.DjangoPropertyImage{},
+		&property.PropertyImageSource{},
+		&SyncRun{},
+		&SyncEvent{},
+		&PropertyChange{},
+		&PriceHistory{},
+		&PriceState{},
+		&PropertyVisibility{},
 	)
 	if err != nil {
 		t.Fatalf("Failed to migrate test database: %v", err)
 	}
 
 	// Clean up tables before test
-	db.Exec("TRUNCATE TABLE core_app_customuser, core_app_property, core_app_property_translation, core_app_propertyimage RESTART IDENTITY CASCADE")
+	db.Exec("TRUNCATE TABLE core_app_customuser, core_app_property, core_app_property_translation, core_app_propertyimage, pf_property_image_source, pf_sync_runs, pf_sync_events, pf_property_changes, pf_property_price_history, pf_property_price_state, pf_property_visibility RESTART IDENTITY CASCADE")
 
 	return db
 }
@@ -53,7 +65,7 @@ func TestSaveOrUpdateUser(t *testing.T) {
 	}
 
 	// Test create
-	saved, err := SaveOrUpdateUser(db, user)
+	saved, err := SaveOrUpdateUser(context.Background(), db, user)
 	if err != nil {
 		t.Fatalf("Failed to save user: %v", err)
 	}
@@ -67,7 +79,7 @@ func TestSaveOrUpdateUser(t *testing.T) {
 
 	// Test update
 	user.Phone = "+9876543210"
-	updated, err := SaveOrUpdateUser(db, user)
+	updated, err := SaveOrUpdateUser(context.Background(), db, user)
 	if err != nil {
 		t.Fatalf("Failed to update user: %v", err)
 	}
@@ -80,7 +92,14 @@ func TestSaveOrUpdateUser(t *testing.T) {
 	}
 }
 
-func TestSaveOrUpdateProperty(t *testing.T) {
+// saveProperty saves a listing without images and returns the property and
+// whether it was created or changed
+func saveProperty(db *gorm.DB, prop property.DjangoProperty, title, desc string) (property.DjangoProperty, bool, error) {
+	result, err := SaveListing(context.Background(), db, ListingWrite{Property: prop, Title: title, Description: desc})
+	return result.Property, result.Changed, err
+}
+
+func TestSaveListingCreatesAndUpdatesProperty(t *testing.T) {
 	db := setupTestDB(t)
 
 	// Create a user first
@@ -93,7 +112,7 @@ func TestSaveOrUpdateProperty(t *testing.T) {
 		IsStaff:     false,
 		IsSuperuser: false,
 	}
-	savedUser, _ := SaveOrUpdateUser(db, user)
+	savedUser, _ := SaveOrUpdateUser(context.Background(), db, user)
 	userID := savedUser.ID
 
 	prop := property.DjangoProperty{
@@ -111,7 +130,10 @@ func TestSaveOrUpdateProperty(t *testing.T) {
 	}
 
 	// Test create
-	saved, created := SaveOrUpdateProperty(db, prop, "Test Property", "Test Description")
+	saved, created, err := saveProperty(db, prop, "Test Property", "Test Description")
+	if err != nil {
+		t.Fatalf("Failed to save property: %v", err)
+	}
 	if !created {
 		t.Error("Property should be created on first save")
 	}
@@ -125,7 +147,10 @@ func TestSaveOrUpdateProperty(t *testing.T) {
 	// Test update
 	prop.Price = 600000
 	prop.Bedrooms = 3
-	updated, changed := SaveOrUpdateProperty(db, prop, "Updated Property", "Updated Description")
+	updated, changed, err := saveProperty(db, prop, "Updated Property", "Updated Description")
+	if err != nil {
+		t.Fatalf("Failed to update property: %v", err)
+	}
 	if !changed {
 		t.Error("Property should be marked as changed when price/bedrooms differ")
 	}
@@ -150,13 +175,16 @@ func TestSaveOrUpdateProperty(t *testing.T) {
 		Slug:             "pf-123",
 		IsVisible:        true,
 	}
-	_, changed = SaveOrUpdateProperty(db, noChangeProp, "Updated Property", "Updated Description")
+	_, changed, err = saveProperty(db, noChangeProp, "Updated Property", "Updated Description")
+	if err != nil {
+		t.Fatalf("Failed to save property: %v", err)
+	}
 	if changed {
 		t.Error("Property should not be marked as changed when values are the same")
 	}
 }
 
-func TestSavePropertyImage(t *testing.T) {
+func TestSaveListingSavesImage(t *testing.T) {
 	db := setupTestDB(t)
 
 	// Create a user and property first
@@ -169,7 +197,7 @@ func TestSavePropertyImage(t *testing.T) {
 		IsStaff:     false,
 		IsSuperuser: false,
 	}
-	savedUser, _ := SaveOrUpdateUser(db, user)
+	savedUser, _ := SaveOrUpdateUser(context.Background(), db, user)
 	userID := savedUser.ID
 
 	prop := property.DjangoProperty{
@@ -185,14 +213,18 @@ func TestSavePropertyImage(t *testing.T) {
 		Slug:             "pf-123",
 		IsVisible:        true,
 	}
-	savedProp, _ := SaveOrUpdateProperty(db, prop, "Test Property", "Test Description")
+	savedProp, _, _ := saveProperty(db, prop, "Test Property", "Test Description")
 
 	img := property.DjangoPropertyImage{
 		PropertyID: savedProp.ID,
 		Image:      "property_images/test.jpg",
 	}
 
-	err := SavePropertyImage(db, img)
+	_, err := SaveListing(context.Background(), db, ListingWrite{
+		Property:  prop,
+		Title:     "Test Property",
+		NewImages: []ImageWrite{{Path: img.Image}},
+	})
 	if err != nil {
 		t.Fatalf("Failed to save property image: %v", err)
 	}
@@ -207,3 +239,561 @@ func TestSavePropertyImage(t *testing.T) {
 		t.Errorf("Expected image path %s, got %s", img.Image, savedImg.Image)
 	}
 }
+
+func TestSaveListing(t *testing.T) {
+	db := setupTestDB(t)
+
+	user := users.DjangoUser{
+		Email:    "agent@example.com",
+		Role:     "agent",
+		Password: "!",
+		IsActive: true,
+	}
+	savedUser, _ := SaveOrUpdateUser(context.Background(), db, user)
+	userID := savedUser.ID
+
+	prop := property.DjangoProperty{
+		PfID:      "pf-456",
+		UserID:    &userID,
+		AreaID:    1,
+		Price:     500000,
+		Slug:      "pf-456",
+		IsVisible: true,
+	}
+
+	result, err := SaveListing(context.Background(), db, ListingWrite{
+		Property:    prop,
+		Title:       "Test Property",
+		Description: "Test Description",
+		NewImages: []ImageWrite{
+			{Path: "property_images/a.jpg", SourceURL: "https://pf.example/a/ce5950dd-d4b0-478e-ad32-176b8900bef1/original.jpg"},
+			{Path: "property_images/b.jpg", SourceURL: "https://pf.example/b/991f8733-ac63-4b7b-8a44-d8586cae82a0/original.jpg"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to save listing: %v", err)
+	}
+	if !result.Created {
+		t.Error("Property should be created on first save")
+	}
+	if result.ImagesAdded != 2 {
+		t.Errorf("Expected 2 images added, got %d", result.ImagesAdded)
+	}
+
+	var translation property.DjangoPropertyTranslation
+	err = db.Where("master_id = ? AND language_code = ?", result.Property.ID, "en").First(&translation).Error
+	if err != nil {
+		t.Fatalf("Failed to find translation: %v", err)
+	}
+
+	// Saving the same images again must not duplicate them
+	var existing property.DjangoPropertyImage
+	db.Where("property_id = ? AND image = ?", result.Property.ID, "property_images/a.jpg").First(&existing)
+
+	result, err = SaveListing(context.Background(), db, ListingWrite{
+		Property:    prop,
+		Title:       "Test Property",
+		Description: "Test Description",
+		NewImages: []ImageWrite{
+			{Path: "property_images/b.jpg", SourceURL: "https://pf.example/b/991f8733-ac63-4b7b-8a44-d8586cae82a0/original.jpg"},
+		},
+		RelinkedImages: map[uint]ImageWrite{
+			existing.ID: {Path: "property_images/c.jpg", SourceURL: "https://pf.example/c/741275b0-4d08-4129-a86c-7a69537e7aba/original.jpg"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to save listing: %v", err)
+	}
+	if result.Created || result.ImagesAdded != 0 || result.ImagesRelinked != 1 {
+		t.Errorf("Unexpected result on second save: %+v", result)
+	}
+
+	var count int64
+	db.Model(&property.DjangoPropertyImage{}).Where("property_id = ?", result.Property.ID).Count(&count)
+	if count != 2 {
+		t.Errorf("Expected 2 image records, got %d", count)
+	}
+
+	// Each image record is linked to the URL it was downloaded from
+	sources, err := GetImageSources(context.Background(), db, []uint{existing.ID})
+	if err != nil {
+		t.Fatalf("Failed to load image sources: %v", err)
+	}
+	if sources[existing.ID].MediaKey != "741275b0-4d08-4129-a86c-7a69537e7aba" {
+		t.Errorf("Expected relinked image source to be updated, got %+v", sources[existing.ID])
+	}
+}
+
+func TestSaveListingRollsBackOnError(t *testing.T) {
+	db := setupTestDB(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := SaveListing(ctx, db, ListingWrite{
+		Property:  property.DjangoProperty{PfID: "pf-789", Slug: "pf-789", AreaID: 1},
+		NewImages: []ImageWrite{{Path: "property_images/a.jpg"}},
+	})
+	if err == nil {
+		t.Fatal("Expected error when the transaction cannot run")
+	}
+
+	var count int64
+	db.Model(&property.DjangoProperty{}).Where("pf_id = ?", "pf-789").Count(&count)
+	if count != 0 {
+		t.Errorf("Expected no property to be saved, got %d", count)
+	}
+}
+
+func TestHideMissingListings(t *testing.T) {
+	db := setupTestDB(t)
+
+	for _, pfID := range []string{"pf-1", "pf-2", "pf-3", "pf-4"} {
+		db.Create(&property.DjangoProperty{PfID: pfID, Slug: pfID, AreaID: 1, IsVisible: true})
+	}
+	// Properties not imported from Property Finder are left alone
+	db.Create(&property.DjangoProperty{Slug: "manual", AreaID: 1, IsVisible: true})
+
+	seen := map[string]bool{"pf-1": true, "pf-2": true, "pf-3": true}
+
+	// 1 of 4 is 25%, above the limit
+	_, err := HideMissingListings(context.Background(), db, seen, 20, 0)
+	if !errors.Is(err, ErrHideThresholdExceeded) {
+		t.Fatalf("Expected ErrHideThresholdExceeded, got %v", err)
+	}
+
+	hidden, err := HideMissingListings(context.Background(), db, seen, 25, 0)
+	if err != nil {
+		t.Fatalf("Failed to hide missing listings: %v", err)
+	}
+	if len(hidden) != 1 || hidden[0] != "pf-4" {
+		t.Errorf("Expected pf-4 hidden, got %v", hidden)
+	}
+
+	var prop property.DjangoProperty
+	db.Where("pf_id = ?", "pf-4").First(&prop)
+	if prop.IsVisible {
+		t.Error("Missing listing should be hidden")
+	}
+
+	var visibility PropertyVisibility
+	if err := db.Where("property_id = ?", prop.ID).First(&visibility).Error; err != nil {
+		t.Fatalf("Expected the hide recorded in pf_property_visibility: %v", err)
+	}
+	if visibility.HiddenAt.IsZero() || visibility.HiddenReason != HiddenNotListed {
+		t.Errorf("Unexpected hide record %+v", visibility)
+	}
+
+	var count int64
+	db.Model(&property.DjangoProperty{}).Count(&count)
+	if count != 5 {
+		t.Errorf("Expected no properties deleted, got %d left", count)
+	}
+	db.Model(&property.DjangoProperty{}).Where("is_visible = ?", true).Count(&count)
+	if count != 4 {
+		t.Errorf("Expected 4 visible properties, got %d", count)
+	}
+
+	changes, err := PropertyHistory(context.Background(), db, prop.ID, "is_visible")
+	if err != nil {
+		t.Fatalf("Failed to load property history: %v", err)
+	}
+	if len(changes) != 1 || changes[0].OldValue != "true" || changes[0].NewValue != "false" {
+		t.Errorf("Expected the hide recorded as is_visible true -> false, got %+v", changes)
+	}
+}
+
+func TestSaveListingOrdersImages(t *testing.T) {
+	db := setupTestDB(t)
+
+	urlA := "https://pf.example/a/ce5950dd-d4b0-478e-ad32-176b8900bef1/original.jpg"
+	urlB := "https://pf.example/b/991f8733-ac63-4b7b-8a44-d8586cae82a0/original.jpg"
+	prop := property.DjangoProperty{PfID: "pf-order", Slug: "pf-order", AreaID: 1, IsVisible: true}
+
+	result, err := SaveListing(context.Background(), db, ListingWrite{
+		Property: prop,
+		NewImages: []ImageWrite{
+			{Path: "property_images/a.jpg", SourceURL: urlA},
+			{Path: "property_images/b.jpg", SourceURL: urlB},
+		},
+		ImageURLs: []string{urlA, urlB},
+	})
+	if err != nil {
+		t.Fatalf("Failed to save listing: %v", err)
+	}
+
+	// The agent moves B to the front on Property Finder
+	result, err = SaveListing(context.Background(), db, ListingWrite{
+		Property:  prop,
+		ImageURLs: []string{urlB, urlA},
+	})
+	if err != nil {
+		t.Fatalf("Failed to save listing: %v", err)
+	}
+	if result.ImagesReordered != 2 {
+		t.Errorf("Expected 2 images reordered, got %d", result.ImagesReordered)
+	}
+
+	var sources []property.PropertyImageSource
+	db.Where("property_id = ?", result.Property.ID).Order("position").Find(&sources)
+	if len(sources) != 2 {
+		t.Fatalf("Expected 2 image sources, got %d", len(sources))
+	}
+	if sources[0].SourceURL != urlB || !sources[0].IsPrimary {
+		t.Errorf("Expected B first and primary, got %+v", sources[0])
+	}
+	if sources[1].SourceURL != urlA || sources[1].IsPrimary {
+		t.Errorf("Expected A second and not primary, got %+v", sources[1])
+	}
+}
+
+func TestSaveListingRetiresRemovedImages(t *testing.T) {
+	db := setupTestDB(t)
+
+	urlA := "https://pf.example/a/ce5950dd-d4b0-478e-ad32-176b8900bef1/original.jpg"
+	urlB := "https://pf.example/b/991f8733-ac63-4b7b-8a44-d8586cae82a0/original.jpg"
+	urlC := "https://pf.example/c/741275b0-4d08-4129-a86c-7a69537e7aba/original.jpg"
+	prop := property.DjangoProperty{PfID: "pf-retire", Slug: "pf-retire", AreaID: 1, IsVisible: true}
+
+	result, err := SaveListing(context.Background(), db, ListingWrite{
+		Property: prop,
+		NewImages: []ImageWrite{
+			{Path: "property_images/ce5950dd-d4b0-478e-ad32-176b8900bef1.jpg", SourceURL: urlA},
+			{Path: "property_images/991f8733-ac63-4b7b-8a44-d8586cae82a0.jpg", SourceURL: urlB},
+			{Path: "property_images/741275b0-4d08-4129-a86c-7a69537e7aba.jpg", SourceURL: urlC},
+		},
+		ImageURLs: []string{urlA, urlB, urlC},
+	})
+	if err != nil {
+		t.Fatalf("Failed to save listing: %v", err)
+	}
+	propID := result.Property.ID
+
+	// B is removed on Property Finder; keep changes nothing
+	result, err = SaveListing(context.Background(), db, ListingWrite{
+		Property:     prop,
+		ImageURLs:    []string{urlA, urlC},
+		RetirePolicy: RetireKeep,
+	})
+	if err != nil || len(result.Retired) != 0 {
+		t.Fatalf("Expected nothing retired with keep, got %v, %v", result.Retired, err)
+	}
+
+	result, err = SaveListing(context.Background(), db, ListingWrite{
+		Property:     prop,
+		ImageURLs:    []string{urlA, urlC},
+		RetirePolicy: RetireFlag,
+	})
+	if err != nil {
+		t.Fatalf("Failed to save listing: %v", err)
+	}
+	if len(result.Retired) != 1 || result.Retired[0].Path != "property_images/991f8733-ac63-4b7b-8a44-d8586cae82a0.jpg" {
+		t.Fatalf("Expected B retired, got %+v", result.Retired)
+	}
+	if !result.Retired[0].Flagged {
+		t.Error("Image retired under flag should keep its file")
+	}
+
+	var src property.PropertyImageSource
+	db.Where("image_id = ?", result.Retired[0].ImageID).First(&src)
+	if src.RetiredAt == nil {
+		t.Error("Flagged image should have retired_at set")
+	}
+
+	// C is removed too; remove deletes its record
+	result, err = SaveListing(context.Background(), db, ListingWrite{
+		Property:     prop,
+		ImageURLs:    []string{urlA},
+		RetirePolicy: RetireRemove,
+	})
+	if err != nil {
+		t.Fatalf("Failed to save listing: %v", err)
+	}
+	if len(result.Retired) != 1 {
+		t.Fatalf("Expected C retired, got %+v", result.Retired)
+	}
+	if result.Retired[0].Flagged {
+		t.Error("Removed image should have its file quarantined")
+	}
+
+	var count int64
+	db.Model(&property.DjangoPropertyImage{}).Where("property_id = ?", propID).Count(&count)
+	if count != 2 {
+		t.Errorf("Expected A and flagged B to remain, got %d records", count)
+	}
+}
+
+func TestParseRetirePolicy(t *testing.T) {
+	for _, s := range []string{"", "keep", "flag", "remove"} {
+		if _, err := ParseRetirePolicy(s); err != nil {
+			t.Errorf("ParseRetirePolicy(%q) failed: %v", s, err)
+		}
+	}
+	if _, err := ParseRetirePolicy("delete"); err == nil {
+		t.Error("Expected error for unknown policy")
+	}
+}
+
+func TestSaveListingLinksKnownContent(t *testing.T) {
+	db := setupTestDB(t)
+
+	prop := property.DjangoProperty{PfID: "pf-hash", Slug: "pf-hash", AreaID: 1, IsVisible: true}
+	result, err := SaveListing(context.Background(), db, ListingWrite{Property: prop})
+	if err != nil {
+		t.Fatalf("Failed to save listing: %v", err)
+	}
+
+	// An older record whose file has the same content as the new download
+	legacy := property.DjangoPropertyImage{PropertyID: result.Property.ID, Image: "property_images/pf_1_0_abc.jpg"}
+	db.Create(&legacy)
+
+	hash := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	result, err = SaveListing(context.Background(), db, ListingWrite{
+		Property: prop,
+		NewImages: []ImageWrite{
+			{Path: "property_images/" + hash + ".jpg", SourceURL: "https://pf.example/a.jpg", ContentHash: hash},
+		},
+		KnownHashes: map[string]uint{hash: legacy.ID},
+	})
+	if err != nil {
+		t.Fatalf("Failed to save listing: %v", err)
+	}
+	if result.ImagesAdded != 0 {
+		t.Errorf("Expected known content not to be added again, got %d", result.ImagesAdded)
+	}
+
+	sources, _ := GetImageSources(context.Background(), db, []uint{legacy.ID})
+	if sources[legacy.ID].ContentHash != hash || sources[legacy.ID].SourceURL != "https://pf.example/a.jpg" {
+		t.Errorf("Expected older record to be linked to the download, got %+v", sources[legacy.ID])
+	}
+}
+
+func TestCheckMissingImages(t *testing.T) {
+	db := setupTestDB(t)
+
+	oldStore := media.Store
+	media.Store = &media.LocalStorage{Root: t.TempDir()}
+	defer func() {
+		media.Store = oldStore
+	}()
+
+	ctx := context.Background()
+	prop := property.DjangoProperty{PfID: "pf-check", Slug: "pf-check", AreaID: 1, IsVisible: true}
+	if err := db.Create(&prop).Error; err != nil {
+		t.Fatalf("Failed to create property: %v", err)
+	}
+
+	present := property.DjangoPropertyImage{PropertyID: prop.ID, Image: "property_images/present.jpg"}
+	missing := property.DjangoPropertyImage{PropertyID: prop.ID, Image: "property_images/missing.jpg"}
+	retired := property.DjangoPropertyImage{PropertyID: prop.ID, Image: "property_images/retired.jpg"}
+	for _, img := range []*property.DjangoPropertyImage{&present, &missing, &retired} {
+		if err := db.Create(img).Error; err != nil {
+			t.Fatalf("Failed to create image: %v", err)
+		}
+	}
+	if err := media.Store.Put(ctx, present.Image, []byte{0xFF, 0xD8}); err != nil {
+		t.Fatalf("Failed to store image: %v", err)
+	}
+	now := time.Now()
+	db.Create(&property.PropertyImageSource{ImageID: retired.ID, PropertyID: prop.ID, RetiredAt: &now})
+
+	checks := 0
+	for check := range ScanImages(ctx, db) {
+		if check.Err != nil {
+			t.Fatalf("ScanImages failed: %v", check.Err)
+		}
+		checks++
+	}
+	if checks != 2 {
+		t.Errorf("Expected the 2 active images checked, got %d", checks)
+	}
+
+	missingImages, err := CheckMissingImages(ctx, db)
+	if err != nil {
+		t.Fatalf("CheckMissingImages failed: %v", err)
+	}
+	if len(missingImages) != 1 {
+		t.Fatalf("Expected 1 missing image, got %+v", missingImages)
+	}
+	if got := missingImages[0]; got.ImageID != missing.ID || got.PfID != "pf-check" || got.ImagePath != missing.Image {
+		t.Errorf("Unexpected missing image %+v", got)
+	}
+}
+
+func TestSyncStateIncrementalSince(t *testing.T) {
+	now := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+	lastRun := now.Add(-24 * time.Hour)
+	recentFull := now.Add(-3 * 24 * time.Hour)
+	oldFull := now.Add(-8 * 24 * time.Hour)
+
+	tests := []struct {
+		name     string
+		state    SyncState
+		interval time.Duration
+		want     bool
+	}{
+		{"never synced", SyncState{}, 168 * time.Hour, false},
+		{"no full run yet", SyncState{LastSyncedAt: &lastRun}, 168 * time.Hour, false},
+		{"recent full run", SyncState{LastSyncedAt: &lastRun, LastFullSyncAt: &recentFull}, 168 * time.Hour, true},
+		{"full run due", SyncState{LastSyncedAt: &lastRun, LastFullSyncAt: &oldFull}, 168 * time.Hour, false},
+		{"incremental disabled", SyncState{LastSyncedAt: &lastRun, LastFullSyncAt: &recentFull}, 0, false},
+	}
+
+	for _, tt := range tests {
+		since, ok := tt.state.IncrementalSince(tt.interval, now)
+		if ok != tt.want {
+			t.Errorf("%s: expected incremental=%v, got %v", tt.name, tt.want, ok)
+		}
+		if ok && !since.Equal(lastRun) {
+			t.Errorf("%s: expected watermark %v, got %v", tt.name, lastRun, since)
+		}
+	}
+}
+
+func TestListingHistory(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	run, err := StartRun(ctx, db, "pf_sync")
+	if err != nil {
+		t.Fatalf("Failed to start run: %v", err)
+	}
+
+	err = RecordEvents(ctx, db, []SyncEvent{
+		{RunID: run.ID, PfID: "pf-1", PropertyID: 1, Action: EventCreated},
+		{RunID: run.ID, PfID: "pf-2", PropertyID: 2, Action: EventUpdated},
+		{RunID: run.ID, PfID: "pf-1", PropertyID: 1, Action: EventImageFailed, Detail: "https://example.com/a.jpg", Error: "status 404"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to record events: %v", err)
+	}
+
+	events, err := ListingHistory(ctx, db, "pf-1")
+	if err != nil {
+		t.Fatalf("Failed to load history: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events for pf-1, got %d", len(events))
+	}
+	if events[0].Action != EventCreated || events[1].Action != EventImageFailed {
+		t.Errorf("Expected created then image_failed, got %s, %s", events[0].Action, events[1].Action)
+	}
+	if events[1].Error != "status 404" || events[1].Command != "pf_sync" {
+		t.Errorf("Unexpected event %+v", events[1])
+	}
+
+	if err := FinishRun(ctx, db, run, RunSucceeded, reporting.ReportStats{PropertiesCreated: 1}, ""); err != nil {
+		t.Fatalf("Failed to finish run: %v", err)
+	}
+	var saved SyncRun
+	db.First(&saved, run.ID)
+	if saved.Status != RunSucceeded || saved.FinishedAt == nil || saved.PropertiesCreated != 1 {
+		t.Errorf("Run not recorded as finished: %+v", saved)
+	}
+}
+
+func TestPropertyChanges(t *testing.T) {
+	existing := property.DjangoProperty{Price: 1500000, Bedrooms: 2, Bathrooms: 2, StatusType: "sale", IsVisible: true}
+	updated := existing
+	updated.Price = 1400000
+	updated.Bedrooms = 3
+
+	changes := propertyChanges(existing, updated)
+	if len(changes) != 2 {
+		t.Fatalf("Expected 2 changes, got %+v", changes)
+	}
+	if changes[0] != (fieldChange{"price", int64(1500000), int64(1400000)}) {
+		t.Errorf("Unexpected price change %+v", changes[0])
+	}
+	if changes[1] != (fieldChange{"bedrooms", 2, 3}) {
+		t.Errorf("Unexpected bedrooms change %+v", changes[1])
+	}
+
+	updates := changesToUpdates(changes)
+	if len(updates) != 2 || updates["price"] != int64(1400000) || updates["bedrooms"] != 3 {
+		t.Errorf("Unexpected updates %v", updates)
+	}
+
+	if changes := propertyChanges(existing, existing); len(changes) != 0 {
+		t.Errorf("Expected no changes, got %+v", changes)
+	}
+}
+
+func TestSaveListingRecordsFieldChanges(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	prop := property.DjangoProperty{PfID: "pf-history", Slug: "pf-history", AreaID: 1, Price: 1500000, Bedrooms: 2, IsVisible: true}
+	if _, err := SaveListing(ctx, db, ListingWrite{Property: prop, Title: "Title"}); err != nil {
+		t.Fatalf("Failed to create listing: %v", err)
+	}
+
+	prop.Price = 1350000
+	result, err := SaveListing(ctx, db, ListingWrite{Property: prop, Title: "Title", RunID: 7})
+	if err != nil {
+		t.Fatalf("Failed to update listing: %v", err)
+	}
+
+	changes, err := PropertyHistory(ctx, db, result.Property.ID, "")
+	if err != nil {
+		t.Fatalf("Failed to load property history: %v", err)
+	}
+	if len(changes) != 1 {
+		t.Fatalf("Expected 1 change, got %+v", changes)
+	}
+	c := changes[0]
+	if c.Field != "price" || c.OldValue != "1500000" || c.NewValue != "1350000" || c.RunID != 7 {
+		t.Errorf("Unexpected change %+v", c)
+	}
+}
+
+func TestSaveListingRecordsPriceHistory(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	prop := property.DjangoProperty{PfID: "pf-price", Slug: "pf-price", AreaID: 1, Price: 2000000, IsVisible: true}
+	created, err := SaveListing(ctx, db, ListingWrite{Property: prop, Title: "Title"})
+	if err != nil {
+		t.Fatalf("Failed to create listing: %v", err)
+	}
+	if created.PriceMovement != nil {
+		t.Errorf("A new property should not report a price movement, got %+v", created.PriceMovement)
+	}
+
+	prop.Price = 1800000
+	result, err := SaveListing(ctx, db, ListingWrite{Property: prop, Title: "Title", RunID: 3})
+	if err != nil {
+		t.Fatalf("Failed to update listing: %v", err)
+	}
+	if result.PriceMovement == nil || result.PriceMovement.OldPrice != 2000000 || result.PriceMovement.NewPrice != 1800000 {
+		t.Fatalf("Unexpected price movement %+v", result.PriceMovement)
+	}
+
+	var history []PriceHistory
+	db.Where("property_id = ?", result.Property.ID).Order("id").Find(&history)
+	if len(history) != 2 {
+		t.Fatalf("Expected 2 price history rows, got %d", len(history))
+	}
+	if history[0].Price != 2000000 || history[0].PreviousPrice != 0 {
+		t.Errorf("Unexpected first price %+v", history[0])
+	}
+	if history[1].Price != 1800000 || history[1].ChangePercent != -10 || history[1].RunID != 3 {
+		t.Errorf("Unexpected price change %+v", history[1])
+	}
+
+	var state PriceState
+	db.First(&state, "property_id = ?", result.Property.ID)
+	if !state.PriceReduced || state.ReducedPercent != 10 || state.PreviousPrice != 2000000 {
+		t.Errorf("Expected a 10%% price reduced badge, got %+v", state)
+	}
+
+	// A price increase clears the badge
+	prop.Price = 1900000
+	if _, err := SaveListing(ctx, db, ListingWrite{Property: prop, Title: "Title"}); err != nil {
+		t.Fatalf("Failed to update listing: %v", err)
+	}
+	db.First(&state, "property_id = ?", result.Property.ID)
+	if state.PriceReduced || state.ReducedPercent != 0 {
+		t.Errorf("Expected the badge cleared after an increase, got %+v", state)
+	}
+}
@@ -0,0 +1,121 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"pfservice/internal/property"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrHideThresholdExceeded is returned when too many properties would be hidden at once
+var ErrHideThresholdExceeded = errors.New("hide threshold exceeded")
+
+// hideBatchSize bounds the number of pf_ids in one UPDATE ... IN (...)
+const hideBatchSize = 500
+
+// FindMissingListings returns the pf_ids of visible properties that are not in seen,
+// together with the number of visible properties imported from Property Finder.
+// Properties without a pf_id were not created by pf_sync and are never returned.
+func FindMissingListings(ctx context.Context, db *gorm.DB, seen map[string]bool) ([]string, int, error) {
+	var pfIDs []string
+	err := db.WithContext(ctx).
+		Model(&property.DjangoProperty{}).
+		Where("is_visible = ? AND pf_id IS NOT NULL AND pf_id <> ''", true).
+		Pluck("pf_id", &pfIDs).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("list visible properties: %w", err)
+	}
+
+	missing := make([]string, 0)
+	for _, pfID := range pfIDs {
+		if !seen[pfID] {
+			missing = append(missing, pfID)
+		}
+	}
+
+	return missing, len(pfIDs), nil
+}
+
+// CheckHideThreshold returns ErrHideThresholdExceeded if hiding missing of
+// visible properties is more than maxPercent
+func CheckHideThreshold(missing, visible, maxPercent int) error {
+	if missing*100 > maxPercent*visible {
+		return fmt.Errorf("%w: %d of %d visible properties missing from the API, limit is %d%%",
+			ErrHideThresholdExceeded, missing, visible, maxPercent)
+	}
+	return nil
+}
+
+// HideMissingListings sets is_visible=false on properties whose pf_id was not
+// seen in a complete listings fetch. Nothing is deleted.
+// It returns the pf_ids hidden. Each hide is recorded as an is_visible change
+// of runID, and its time and reason in pf_property_visibility.
+// If more than maxPercent of the visible properties would be hidden, nothing is
+// changed and ErrHideThresholdExceeded is returned.
+func HideMissingListings(ctx context.Context, db *gorm.DB, seen map[string]bool, maxPercent int, runID uint) ([]string, error) {
+	missing, visible, err := FindMissingListings(ctx, db, seen)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(missing) == 0 {
+		return nil, nil
+	}
+
+	if err := CheckHideThreshold(len(missing), visible, maxPercent); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for start := 0; start < len(missing); start += hideBatchSize {
+			end := min(start+hideBatchSize, len(missing))
+
+			var propertyIDs []uint
+			err := tx.Model(&property.DjangoProperty{}).
+				Where("pf_id IN ?", missing[start:end]).
+				Pluck("id", &propertyIDs).Error
+			if err != nil {
+				return fmt.Errorf("find properties to hide: %w", err)
+			}
+			if len(propertyIDs) > 0 {
+				changes := make([]PropertyChange, 0, len(propertyIDs))
+				for _, propertyID := range propertyIDs {
+					changes = append(changes, PropertyChange{
+						PropertyID: propertyID,
+						Field:      "is_visible",
+						OldValue:   "true",
+						NewValue:   "false",
+						RunID:      runID,
+						ChangedAt:  now,
+					})
+				}
+				if err := tx.Create(&changes).Error; err != nil {
+					return fmt.Errorf("record hidden properties: %w", err)
+				}
+				if err := recordHidden(tx, propertyIDs, HiddenNotListed, runID, now); err != nil {
+					return err
+				}
+			}
+
+			err = tx.Model(&property.DjangoProperty{}).
+				Where("pf_id IN ?", missing[start:end]).
+				Updates(map[string]interface{}{
+					"is_visible": false,
+					"updated_at": now,
+				}).Error
+			if err != nil {
+				return fmt.Errorf("hide properties: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return missing, nil
+}
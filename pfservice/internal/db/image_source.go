@@ -0,0 +1,158 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"pfservice/internal/property"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GetImageSources returns the source records for imageIDs, keyed by image ID.
+// Images without a source record are not in the map. If the table has not been
+// created yet (e.g. a dry run before the first migration) the map is empty.
+func GetImageSources(ctx context.Context, db *gorm.DB, imageIDs []uint) (map[uint]property.PropertyImageSource, error) {
+	sources := make(map[uint]property.PropertyImageSource)
+	if len(imageIDs) == 0 || !db.Migrator().HasTable(&property.PropertyImageSource{}) {
+		return sources, nil
+	}
+
+	var rows []property.PropertyImageSource
+	err := db.WithContext(ctx).Where("image_id IN ?", imageIDs).Find(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("load image sources: %w", err)
+	}
+
+	for _, row := range rows {
+		sources[row.ImageID] = row
+	}
+	return sources, nil
+}
+
+// SaveImageSource records the URL an image was downloaded from and the hash of
+// its content, replacing any earlier source for the same image.
+// An empty contentHash keeps the stored one.
+func SaveImageSource(ctx context.Context, db *gorm.DB, imageID, propertyID uint, sourceURL, contentHash string) error {
+	src := property.PropertyImageSource{
+		ImageID:     imageID,
+		PropertyID:  propertyID,
+		SourceURL:   sourceURL,
+		MediaKey:    property.MediaKey(sourceURL),
+		ContentHash: contentHash,
+	}
+
+	// A retired image that is downloaded again is active again
+	columns := []string{"property_id", "source_url", "media_key", "retired_at", "updated_at"}
+	if contentHash != "" {
+		columns = append(columns, "content_hash")
+	}
+
+	err := db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "image_id"}},
+		DoUpdates: clause.AssignmentColumns(columns),
+	}).Create(&src).Error
+	if err != nil {
+		return fmt.Errorf("save source for image %d: %w", imageID, err)
+	}
+	return nil
+}
+
+// RelinkPropertyImage points an existing image record at a re-downloaded file
+// and records its source URL and content hash, in one transaction
+func RelinkPropertyImage(ctx context.Context, db *gorm.DB, imageID, propertyID uint, path, sourceURL, contentHash string) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return relinkPropertyImage(tx, imageID, propertyID, path, sourceURL, contentHash)
+	})
+}
+
+func relinkPropertyImage(tx *gorm.DB, imageID, propertyID uint, path, sourceURL, contentHash string) error {
+	res := tx.Model(&property.DjangoPropertyImage{}).
+		Where("id = ? AND property_id = ?", imageID, propertyID).
+		Update("image", path)
+	if res.Error != nil {
+		return fmt.Errorf("relink image %d: %w", imageID, res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return fmt.Errorf("relink image %d: %w", imageID, gorm.ErrRecordNotFound)
+	}
+
+	return SaveImageSource(tx.Statement.Context, tx, imageID, propertyID, sourceURL, contentHash)
+}
+
+// orderPropertyImages sets the position and cover flag of each image of the
+// property from its place in urls, the listing's images in Property Finder order.
+// Older images without a source record get one when they can be matched by filename.
+// Images not in the listing keep their position and lose the cover flag.
+// It returns the number of images whose position or cover flag changed.
+func orderPropertyImages(tx *gorm.DB, propertyID uint, urls []string) (int, error) {
+	var images []property.DjangoPropertyImage
+	if err := tx.Where("property_id = ?", propertyID).Order("id").Find(&images).Error; err != nil {
+		return 0, fmt.Errorf("list images for property %d: %w", propertyID, err)
+	}
+	if len(images) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]uint, 0, len(images))
+	for _, img := range images {
+		ids = append(ids, img.ID)
+	}
+	sources, err := GetImageSources(tx.Statement.Context, tx, ids)
+	if err != nil {
+		return 0, err
+	}
+
+	// The cover is the first image the listing actually has
+	primary := -1
+	for i, u := range urls {
+		if u != "" {
+			primary = i
+			break
+		}
+	}
+
+	changed := 0
+	for _, img := range images {
+		var src *property.PropertyImageSource
+		if row, ok := sources[img.ID]; ok {
+			src = &row
+		}
+
+		position := -1
+		if len(urls) > 0 {
+			position = property.MatchImageURL(img, src, urls)
+		}
+
+		if src == nil {
+			if position < 0 {
+				continue
+			}
+			if err := SaveImageSource(tx.Statement.Context, tx, img.ID, propertyID, urls[position], ""); err != nil {
+				return 0, err
+			}
+			src = &property.PropertyImageSource{ImageID: img.ID}
+		}
+
+		updates := map[string]interface{}{}
+		if position >= 0 && src.Position != position {
+			updates["position"] = position
+		}
+		if isPrimary := position >= 0 && position == primary; src.IsPrimary != isPrimary {
+			updates["is_primary"] = isPrimary
+		}
+		if len(updates) == 0 {
+			continue
+		}
+
+		err := tx.Model(&property.PropertyImageSource{}).
+			Where("image_id = ?", img.ID).
+			Updates(updates).Error
+		if err != nil {
+			return 0, fmt.Errorf("order image %d: %w", img.ID, err)
+		}
+		changed++
+	}
+
+	return changed, nil
+}
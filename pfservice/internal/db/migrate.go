@@ -0,0 +1,28 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"pfservice/internal/property"
+
+	"gorm.io/gorm"
+)
+
+// Migrate creates or updates the tables owned by this service.
+// Django owns the core_app_* tables; they are never migrated here.
+func Migrate(ctx context.Context, db *gorm.DB) error {
+	err := db.WithContext(ctx).AutoMigrate(
+		&property.PropertyImageSource{},
+		&SyncState{},
+		&SyncRun{},
+		&SyncEvent{},
+		&PropertyChange{},
+		&PriceHistory{},
+		&PriceState{},
+		&PropertyVisibility{},
+	)
+	if err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+	return nil
+}
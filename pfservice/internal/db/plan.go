@@ -0,0 +1,82 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"pfservice/internal/property"
+	"pfservice/internal/users"
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+// Action is what a save function would do with a record
+type Action string
+
+const (
+	ActionCreate Action = "create"
+	ActionUpdate Action = "update"
+	ActionNone   Action = "none"
+)
+
+// PlanUser reports what SaveOrUpdateUser would do with u without writing.
+// For an update it also returns the columns that would change.
+func PlanUser(ctx context.Context, db *gorm.DB, u users.DjangoUser) (Action, []string, error) {
+	var existing users.DjangoUser
+
+	err := db.WithContext(ctx).Where("email = ?", u.Email).First(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ActionCreate, nil, nil
+	}
+	if err != nil {
+		return ActionNone, nil, fmt.Errorf("find user %s: %w", u.Email, err)
+	}
+
+	var fields []string
+	if existing.Phone != u.Phone {
+		fields = append(fields, "phone")
+	}
+	if existing.Avatar != normalizeAvatar(u.Avatar) {
+		fields = append(fields, "avatar")
+	}
+	if existing.Role != u.Role {
+		fields = append(fields, "role")
+	}
+	if existing.IsActive != u.IsActive {
+		fields = append(fields, "is_active")
+	}
+
+	if len(fields) == 0 {
+		return ActionNone, nil, nil
+	}
+	return ActionUpdate, fields, nil
+}
+
+// PlanProperty reports what SaveListing would do with prop without
+// writing. It returns the stored property when there is one, and for an update
+// the columns that would change.
+func PlanProperty(ctx context.Context, db *gorm.DB, prop property.DjangoProperty) (Action, []string, *property.DjangoProperty, error) {
+	var existing property.DjangoProperty
+
+	err := db.WithContext(ctx).Where("pf_id = ?", prop.PfID).First(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ActionCreate, nil, nil, nil
+	}
+	if err != nil {
+		return ActionNone, nil, nil, fmt.Errorf("find property %s: %w", prop.PfID, err)
+	}
+
+	changes := propertyChanges(existing, prop)
+	if len(changes) == 0 {
+		return ActionNone, nil, &existing, nil
+	}
+
+	fields := make([]string, 0, len(changes))
+	for _, c := range changes {
+		fields = append(fields, c.Field)
+	}
+	sort.Strings(fields)
+
+	return ActionUpdate, fields, &existing, nil
+}
@@ -0,0 +1,85 @@
+package db
+
+import (
+	"fmt"
+	"pfservice/internal/reporting"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PriceHistory is one price of a property. A row is appended when the
+// property is created and whenever its price changes.
+type PriceHistory struct {
+	ID         uint   `gorm:"column:id;primaryKey"`
+	PropertyID uint   `gorm:"column:property_id;index"`
+	PfID       string `gorm:"column:pf_id;index"`
+	Price      int64  `gorm:"column:price"`
+	// PreviousPrice is 0 for the first price of a property
+	PreviousPrice int64 `gorm:"column:previous_price"`
+	// ChangePercent is negative for a reduction
+	ChangePercent float64 `gorm:"column:change_percent"`
+	// RunID is the pf_sync_runs row, or 0 if the run was not recorded
+	RunID      uint      `gorm:"column:run_id;index"`
+	RecordedAt time.Time `gorm:"column:recorded_at;index"`
+}
+
+func (PriceHistory) TableName() string {
+	return "pf_property_price_history"
+}
+
+// PriceState is the "price reduced" badge of a property. It lives in its
+// own table so the Django schema is unchanged.
+type PriceState struct {
+	PropertyID uint `gorm:"column:property_id;primaryKey;autoIncrement:false"`
+	// PriceReduced is set when the last price change was a reduction
+	PriceReduced bool `gorm:"column:price_reduced;not null;default:false;index"`
+	// ReducedPercent is how much the last reduction took off, e.g. 10.5
+	ReducedPercent float64   `gorm:"column:reduced_percent;not null;default:0"`
+	PreviousPrice  int64     `gorm:"column:previous_price"`
+	UpdatedAt      time.Time `gorm:"column:updated_at"`
+}
+
+func (PriceState) TableName() string {
+	return "pf_property_price_state"
+}
+
+// recordPrice appends the property's price to its history and updates its
+// price reduced badge. A zero OldPrice records the first price.
+func recordPrice(db *gorm.DB, move reporting.PriceMovement, runID uint, at time.Time) error {
+	row := PriceHistory{
+		PropertyID:    move.PropertyID,
+		PfID:          move.PfID,
+		Price:         move.NewPrice,
+		PreviousPrice: move.OldPrice,
+		ChangePercent: move.Percent(),
+		RunID:         runID,
+		RecordedAt:    at,
+	}
+	if err := db.Create(&row).Error; err != nil {
+		return fmt.Errorf("record price of property %d: %w", move.PropertyID, err)
+	}
+
+	if move.OldPrice == 0 {
+		return nil
+	}
+
+	state := PriceState{
+		PropertyID:    move.PropertyID,
+		PriceReduced:  move.NewPrice < move.OldPrice,
+		PreviousPrice: move.OldPrice,
+		UpdatedAt:     at,
+	}
+	if state.PriceReduced {
+		state.ReducedPercent = -move.Percent()
+	}
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "property_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"price_reduced", "reduced_percent", "previous_price", "updated_at"}),
+	}).Create(&state).Error
+	if err != nil {
+		return fmt.Errorf("save price state of property %d: %w", move.PropertyID, err)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PropertyChange is one column value changed on a property
+type PropertyChange struct {
+	ID         uint   `gorm:"column:id;primaryKey"`
+	PropertyID uint   `gorm:"column:property_id;index"`
+	Field      string `gorm:"column:field;index"`
+	// OldValue and NewValue are the column values as text
+	OldValue string `gorm:"column:old_value"`
+	NewValue string `gorm:"column:new_value"`
+	// RunID is the pf_sync_runs row, or 0 if the run was not recorded
+	RunID     uint      `gorm:"column:run_id;index"`
+	ChangedAt time.Time `gorm:"column:changed_at;index"`
+}
+
+func (PropertyChange) TableName() string {
+	return "pf_property_changes"
+}
+
+// fieldChange is a column that differs between the stored and the new property
+type fieldChange struct {
+	Field    string
+	Old, New interface{}
+}
+
+// recordPropertyChanges stores changes of propertyID applied at changedAt
+func recordPropertyChanges(db *gorm.DB, propertyID, runID uint, changes []fieldChange, changedAt time.Time) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	rows := make([]PropertyChange, 0, len(changes))
+	for _, c := range changes {
+		rows = append(rows, PropertyChange{
+			PropertyID: propertyID,
+			Field:      c.Field,
+			OldValue:   fmt.Sprint(c.Old),
+			NewValue:   fmt.Sprint(c.New),
+			RunID:      runID,
+			ChangedAt:  changedAt,
+		})
+	}
+	if err := db.Create(&rows).Error; err != nil {
+		return fmt.Errorf("record changes of property %d: %w", propertyID, err)
+	}
+	return nil
+}
+
+// PropertyHistory returns the recorded changes of propertyID, oldest first,
+// optionally limited to one field
+func PropertyHistory(ctx context.Context, db *gorm.DB, propertyID uint, field string) ([]PropertyChange, error) {
+	var changes []PropertyChange
+	if !db.Migrator().HasTable(&PropertyChange{}) {
+		return changes, nil
+	}
+
+	query := db.WithContext(ctx).Where("property_id = ?", propertyID)
+	if field != "" {
+		query = query.Where("field = ?", field)
+	}
+	if err := query.Order("changed_at, id").Find(&changes).Error; err != nil {
+		return nil, fmt.Errorf("load history of property %d: %w", propertyID, err)
+	}
+	return changes, nil
+}
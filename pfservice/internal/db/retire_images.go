@@ -0,0 +1,166 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"pfservice/internal/property"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RetirePolicy decides what happens to images removed from a listing on Property Finder
+type RetirePolicy string
+
+const (
+	// RetireKeep leaves removed images untouched
+	RetireKeep RetirePolicy = "keep"
+	// RetireFlag is bookkeeping only: it sets retired_at on the image source
+	// and keeps the record and its file, so the site still shows the image.
+	// Use RetireRemove to take images off the site.
+	RetireFlag RetirePolicy = "flag"
+	// RetireRemove deletes the image record and quarantines the file
+	RetireRemove RetirePolicy = "remove"
+)
+
+// ParseRetirePolicy validates a PF_IMAGE_RETIRE_POLICY value; "" means keep
+func ParseRetirePolicy(s string) (RetirePolicy, error) {
+	switch RetirePolicy(s) {
+	case "", RetireKeep:
+		return RetireKeep, nil
+	case RetireFlag, RetireRemove:
+		return RetirePolicy(s), nil
+	}
+	return RetireKeep, fmt.Errorf("unknown image retire policy %q (want keep, flag or remove)", s)
+}
+
+// RetiredImage is an image retired by SaveListing
+type RetiredImage struct {
+	ImageID uint
+	Path    string
+	// Flagged is set under RetireFlag, where the record and its file are kept
+	Flagged bool
+	// Shared is set when another active image record uses the same file,
+	// which must then stay in place
+	Shared bool
+}
+
+// FindRetiredImages returns the property's active images that are no longer in
+// urls, the listing's images on Property Finder. Images whose Property Finder
+// media is unknown are never returned, and nothing is returned when the listing
+// has no images at all.
+func FindRetiredImages(ctx context.Context, db *gorm.DB, propertyID uint, urls []string) ([]property.DjangoPropertyImage, error) {
+	hasURL := false
+	for _, u := range urls {
+		if u != "" {
+			hasURL = true
+			break
+		}
+	}
+	if !hasURL {
+		return nil, nil
+	}
+
+	var images []property.DjangoPropertyImage
+	if err := db.WithContext(ctx).Where("property_id = ?", propertyID).Order("id").Find(&images).Error; err != nil {
+		return nil, fmt.Errorf("list images for property %d: %w", propertyID, err)
+	}
+
+	ids := make([]uint, 0, len(images))
+	for _, img := range images {
+		ids = append(ids, img.ID)
+	}
+	sources, err := GetImageSources(ctx, db, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	var retired []property.DjangoPropertyImage
+	for _, img := range images {
+		var src *property.PropertyImageSource
+		if row, ok := sources[img.ID]; ok {
+			src = &row
+		}
+		if src != nil && src.RetiredAt != nil {
+			continue
+		}
+		if property.ImageMediaKey(img, src) == "" {
+			continue
+		}
+		if property.MatchImageURL(img, src, urls) >= 0 {
+			continue
+		}
+		retired = append(retired, img)
+	}
+
+	return retired, nil
+}
+
+// retireImages applies policy to the property's images that are no longer in urls.
+// Files are not touched here; the caller quarantines the files of removed
+// records after the commit.
+func retireImages(tx *gorm.DB, propertyID uint, urls []string, policy RetirePolicy) ([]RetiredImage, error) {
+	if policy == "" || policy == RetireKeep {
+		return nil, nil
+	}
+
+	images, err := FindRetiredImages(tx.Statement.Context, tx, propertyID, urls)
+	if err != nil || len(images) == 0 {
+		return nil, err
+	}
+
+	ids := make([]uint, 0, len(images))
+	for _, img := range images {
+		ids = append(ids, img.ID)
+	}
+
+	now := time.Now()
+	retired := make([]RetiredImage, 0, len(images))
+	for _, img := range images {
+		if policy == RetireFlag {
+			src := property.PropertyImageSource{
+				ImageID:    img.ID,
+				PropertyID: propertyID,
+				MediaKey:   property.ImageMediaKey(img, nil),
+				RetiredAt:  &now,
+			}
+			err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "image_id"}},
+				DoUpdates: clause.AssignmentColumns([]string{"retired_at", "is_primary", "updated_at"}),
+			}).Create(&src).Error
+			if err != nil {
+				return nil, fmt.Errorf("flag image %d: %w", img.ID, err)
+			}
+			retired = append(retired, RetiredImage{ImageID: img.ID, Path: img.Image, Flagged: true})
+			continue
+		}
+
+		// The same file can back active images of other properties
+		var shared int64
+		err := tx.Model(&property.DjangoPropertyImage{}).
+			Where("image = ? AND id NOT IN ?", img.Image, ids).
+			Where("NOT EXISTS (?)", tx.Model(&property.PropertyImageSource{}).
+				Select("1").
+				Where("pf_property_image_source.image_id = core_app_propertyimage.id AND pf_property_image_source.retired_at IS NOT NULL")).
+			Count(&shared).Error
+		if err != nil {
+			return nil, fmt.Errorf("check image %s: %w", img.Image, err)
+		}
+
+		if err := tx.Where("image_id = ?", img.ID).Delete(&property.PropertyImageSource{}).Error; err != nil {
+			return nil, fmt.Errorf("remove source for image %d: %w", img.ID, err)
+		}
+		if err := tx.Delete(&property.DjangoPropertyImage{}, img.ID).Error; err != nil {
+			return nil, fmt.Errorf("remove image %d: %w", img.ID, err)
+		}
+
+		retired = append(retired, RetiredImage{
+			ImageID: img.ID,
+			Path:    img.Image,
+			Shared:  shared > 0,
+		})
+	}
+
+	return retired, nil
+}
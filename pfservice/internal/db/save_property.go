@@ -1,64 +1,246 @@
 package db
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"pfservice/internal/property"
+	"pfservice/internal/reporting"
+	"time"
+
 	"gorm.io/gorm"
-	"errors"
 )
 
-func SaveOrUpdateProperty(
+// ListingWrite is everything pf_sync writes for one listing.
+// It is applied in a single transaction by SaveListing.
+type ListingWrite struct {
+	Property    property.DjangoProperty
+	Title       string
+	Description string
+
+	// NewImages are downloaded images to attach to the property
+	NewImages []ImageWrite
+	// RelinkedImages maps existing image record IDs to re-downloaded images
+	RelinkedImages map[uint]ImageWrite
+	// ImageURLs are the listing's image URLs in Property Finder order;
+	// they set the position and cover flag of the property's images
+	ImageURLs []string
+	// RetirePolicy applies to images no longer in ImageURLs
+	RetirePolicy RetirePolicy
+	// KnownHashes maps content hashes to images the property already has.
+	// A new image with one of these hashes is linked to that record instead
+	// of creating another.
+	KnownHashes map[string]uint
+	// RunID is recorded with the property's field changes
+	RunID uint
+}
+
+// ImageWrite is a downloaded image and the Property Finder URL it came from
+type ImageWrite struct {
+	Path        string
+	SourceURL   string
+	ContentHash string
+}
+
+// ListingResult reports what SaveListing changed
+type ListingResult struct {
+	Property        property.DjangoProperty
+	Created         bool
+	Changed         bool
+	ImagesAdded     int
+	ImagesRelinked  int
+	ImagesReordered int
+	// Retired images; their files are still in place
+	Retired []RetiredImage
+	// PriceMovement is set when the price of an existing property changed
+	PriceMovement *reporting.PriceMovement
+}
+
+// SaveListing writes the property, its English translation and its image rows
+// in one transaction. On error nothing from this listing is kept.
+func SaveListing(ctx context.Context, db *gorm.DB, w ListingWrite) (ListingResult, error) {
+	var result ListingResult
+
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		saved, created, changes, err := saveOrUpdateProperty(tx, w.Property, w.Title, w.Description, w.RunID)
+		if err != nil {
+			return err
+		}
+
+		result = ListingResult{
+			Property: saved,
+			Created:  created,
+			Changed:  created || len(changes) > 0,
+		}
+		for _, c := range changes {
+			if c.Field == "is_visible" {
+				if err := clearHidden(tx, saved.ID); err != nil {
+					return err
+				}
+			}
+			if c.Field == "price" {
+				result.PriceMovement = &reporting.PriceMovement{
+					PropertyID: saved.ID,
+					PfID:       saved.PfID,
+					OldPrice:   c.Old.(int64),
+					NewPrice:   c.New.(int64),
+				}
+			}
+		}
+
+		for imageID, img := range w.RelinkedImages {
+			if err := relinkPropertyImage(tx, imageID, saved.ID, img.Path, img.SourceURL, img.ContentHash); err != nil {
+				return err
+			}
+			result.ImagesRelinked++
+		}
+
+		for _, img := range w.NewImages {
+			// The same content is already attached under an older record
+			if imageID, ok := w.KnownHashes[img.ContentHash]; ok && img.ContentHash != "" {
+				if err := SaveImageSource(ctx, tx, imageID, saved.ID, img.SourceURL, img.ContentHash); err != nil {
+					return err
+				}
+				continue
+			}
+
+			// Paths already attached to this property only get their source recorded
+			var existing property.DjangoPropertyImage
+			err := tx.Where("property_id = ? AND image = ?", saved.ID, img.Path).First(&existing).Error
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("check image %s: %w", img.Path, err)
+			}
+
+			if err != nil {
+				existing = property.DjangoPropertyImage{
+					PropertyID: saved.ID,
+					Image:      img.Path,
+				}
+				if err := tx.Create(&existing).Error; err != nil {
+					return fmt.Errorf("save image %s: %w", img.Path, err)
+				}
+				result.ImagesAdded++
+			}
+
+			if err := SaveImageSource(ctx, tx, existing.ID, saved.ID, img.SourceURL, img.ContentHash); err != nil {
+				return err
+			}
+		}
+
+		retired, err := retireImages(tx, saved.ID, w.ImageURLs, w.RetirePolicy)
+		if err != nil {
+			return err
+		}
+		result.Retired = retired
+
+		reordered, err := orderPropertyImages(tx, saved.ID, w.ImageURLs)
+		if err != nil {
+			return err
+		}
+		result.ImagesReordered = reordered
+
+		return nil
+	})
+
+	if err != nil {
+		return ListingResult{}, err
+	}
+
+	return result, nil
+}
+
+func saveOrUpdateProperty(
 	db *gorm.DB,
 	prop property.DjangoProperty,
 	title string,
 	desc string,
-) (property.DjangoProperty, bool) {
+	runID uint,
+) (saved property.DjangoProperty, created bool, changes []fieldChange, err error) {
 
 	var existing property.DjangoProperty
 
-	err := db.Where("pf_id = ?", prop.PfID).First(&existing).Error
+	err = db.Where("pf_id = ?", prop.PfID).First(&existing).Error
 
 	if errors.Is(err, gorm.ErrRecordNotFound) {
-		db.Create(&prop)
-		property.SaveEnglishTranslation(db, prop.ID, title, "", desc)
-		return prop, true
+		if err := db.Create(&prop).Error; err != nil {
+			return prop, false, nil, fmt.Errorf("create property %s: %w", prop.PfID, err)
+		}
+		if err := property.SaveEnglishTranslation(db, prop.ID, title, "", desc); err != nil {
+			return prop, false, nil, fmt.Errorf("save translation for property %s: %w", prop.PfID, err)
+		}
+		// The first price starts the property's price history
+		first := reporting.PriceMovement{PropertyID: prop.ID, PfID: prop.PfID, NewPrice: prop.Price}
+		if err := recordPrice(db, first, runID, time.Now()); err != nil {
+			return prop, false, nil, err
+		}
+		return prop, true, nil, nil
 	}
 
 	if err != nil {
-		return existing, false
+		return existing, false, nil, fmt.Errorf("find property %s: %w", prop.PfID, err)
 	}
 
-	updates := map[string]interface{}{}
+	changes = propertyChanges(existing, prop)
+
+	if len(changes) > 0 {
+		now := time.Now()
+		oldPrice := existing.Price
+		if err := db.Model(&existing).Updates(changesToUpdates(changes)).Error; err != nil {
+			return existing, false, nil, fmt.Errorf("update property %s: %w", prop.PfID, err)
+		}
+		if err := recordPropertyChanges(db, existing.ID, runID, changes, now); err != nil {
+			return existing, false, nil, err
+		}
+		if prop.Price != oldPrice {
+			move := reporting.PriceMovement{PropertyID: existing.ID, PfID: existing.PfID, OldPrice: oldPrice, NewPrice: prop.Price}
+			if err := recordPrice(db, move, runID, now); err != nil {
+				return existing, false, nil, err
+			}
+		}
+	}
+
+	if err := property.SaveEnglishTranslation(db, existing.ID, title, "", desc); err != nil {
+		return existing, false, nil, fmt.Errorf("save translation for property %s: %w", prop.PfID, err)
+	}
+
+	return existing, false, changes, nil
+}
+
+// propertyChanges returns the columns of existing that differ from prop,
+// with their old and new values
+func propertyChanges(existing, prop property.DjangoProperty) []fieldChange {
+	var changes []fieldChange
 
 	if existing.Price != prop.Price {
-		updates["price"] = prop.Price
+		changes = append(changes, fieldChange{"price", existing.Price, prop.Price})
 	}
 	if existing.Bedrooms != prop.Bedrooms {
-		updates["bedrooms"] = prop.Bedrooms
+		changes = append(changes, fieldChange{"bedrooms", existing.Bedrooms, prop.Bedrooms})
 	}
 	if existing.Bathrooms != prop.Bathrooms {
-		updates["bathrooms"] = prop.Bathrooms
+		changes = append(changes, fieldChange{"bathrooms", existing.Bathrooms, prop.Bathrooms})
 	}
 	if existing.SquareSqft != prop.SquareSqft {
-		updates["square_sqft"] = prop.SquareSqft
+		changes = append(changes, fieldChange{"square_sqft", existing.SquareSqft, prop.SquareSqft})
 	}
 	if existing.StatusType != prop.StatusType {
-		updates["status_type"] = prop.StatusType
+		changes = append(changes, fieldChange{"status_type", existing.StatusType, prop.StatusType})
 	}
 	if existing.ConstructionType != prop.ConstructionType {
-		updates["construction_type"] = prop.ConstructionType
+		changes = append(changes, fieldChange{"construction_type", existing.ConstructionType, prop.ConstructionType})
 	}
 	if !existing.IsVisible {
-		updates["is_visible"] = true
+		changes = append(changes, fieldChange{"is_visible", false, true})
 	}
 
-	changed := len(updates) > 0
+	return changes
+}
 
-	if changed {
-		db.Model(&existing).Updates(updates)
+// changesToUpdates returns changes as a column update map
+func changesToUpdates(changes []fieldChange) map[string]interface{} {
+	updates := map[string]interface{}{}
+	for _, c := range changes {
+		updates[c.Field] = c.New
 	}
-
-	property.SaveEnglishTranslation(db, existing.ID, title, "", desc)
-
-	return existing, changed
+	return updates
 }
-
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"errors"
 	"pfservice/internal/users"
 	"strings"
@@ -21,7 +22,9 @@ func normalizeAvatar(avatar string) string {
 }
 
 
-func SaveOrUpdateUser(db *gorm.DB, u users.DjangoUser) (users.DjangoUser, error) {
+func SaveOrUpdateUser(ctx context.Context, db *gorm.DB, u users.DjangoUser) (users.DjangoUser, error) {
+	db = db.WithContext(ctx)
+
 	var existing users.DjangoUser
 
 	err := db.Where("email = ?", u.Email).First(&existing).Error
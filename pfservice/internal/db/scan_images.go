@@ -0,0 +1,144 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	media "pfservice/internal/media_download"
+	"pfservice/internal/property"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// imageScanBatchSize is how many image rows are read per query
+	imageScanBatchSize = 1000
+	// imageCheckWorkers bounds how many files are checked at the same time
+	imageCheckWorkers = 16
+)
+
+// ImageCheck is the result of checking one image record's file, sent by ScanImages
+type ImageCheck struct {
+	Image  MissingImageInfo
+	Exists bool
+	// Err is set on the last value sent when the scan stopped early;
+	// Image is empty then
+	Err error
+}
+
+// ScanImages checks the file of every active image record and sends one
+// ImageCheck per image, in no particular order. Records are read in batches
+// with their property's pf_id; images of missing properties and retired images
+// are skipped. The channel is closed when the scan ends and must be drained.
+func ScanImages(ctx context.Context, db *gorm.DB) <-chan ImageCheck {
+	out := make(chan ImageCheck, imageCheckWorkers)
+
+	go func() {
+		defer close(out)
+
+		// The first storage error stops the scan
+		ctx, cancel := context.WithCancelCause(ctx)
+		defer cancel(nil)
+
+		rows := make(chan imageRow, imageScanBatchSize)
+		var wg sync.WaitGroup
+		for i := 0; i < imageCheckWorkers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for row := range rows {
+					if ctx.Err() != nil {
+						continue
+					}
+					exists, err := media.Store.Exists(ctx, row.Image)
+					if err != nil {
+						cancel(fmt.Errorf("check image %s: %w", row.Image, err))
+						continue
+					}
+					select {
+					case out <- ImageCheck{Image: row.info(), Exists: exists}:
+					case <-ctx.Done():
+					}
+				}
+			}()
+		}
+
+		err := eachImageBatch(ctx, db, func(batch []imageRow) error {
+			for _, row := range batch {
+				select {
+				case rows <- row:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			return nil
+		})
+		close(rows)
+		wg.Wait()
+
+		if cause := context.Cause(ctx); cause != nil {
+			err = cause
+		}
+		if err != nil {
+			out <- ImageCheck{Err: err}
+		}
+	}()
+
+	return out
+}
+
+// imageRow is an image record joined with its property's pf_id
+type imageRow struct {
+	ImageID    uint
+	PropertyID uint
+	PfID       string
+	Image      string
+}
+
+func (r imageRow) info() MissingImageInfo {
+	return MissingImageInfo{
+		ImageID:    r.ImageID,
+		PropertyID: r.PropertyID,
+		PfID:       r.PfID,
+		ImagePath:  r.Image,
+	}
+}
+
+// eachImageBatch calls fn with the active image records in ID order, up to
+// imageScanBatchSize at a time. Images of missing properties and retired
+// images are left out.
+func eachImageBatch(ctx context.Context, db *gorm.DB, fn func([]imageRow) error) error {
+	db = db.WithContext(ctx)
+	hasSources := db.Migrator().HasTable(&property.PropertyImageSource{})
+
+	lastID := uint(0)
+	for {
+		query := db.Table("core_app_propertyimage AS i").
+			Select("i.id AS image_id, i.property_id, COALESCE(p.pf_id, '') AS pf_id, i.image").
+			Joins("JOIN core_app_property AS p ON p.id = i.property_id").
+			Where("i.id > ?", lastID).
+			Order("i.id").
+			Limit(imageScanBatchSize)
+		if hasSources {
+			// Retired images are skipped; their files may be in quarantine
+			query = query.
+				Joins("LEFT JOIN pf_property_image_source AS s ON s.image_id = i.id").
+				Where("s.retired_at IS NULL")
+		}
+
+		var batch []imageRow
+		if err := query.Scan(&batch).Error; err != nil {
+			return fmt.Errorf("read images after id %d: %w", lastID, err)
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := fn(batch); err != nil {
+			return err
+		}
+		if len(batch) < imageScanBatchSize {
+			return nil
+		}
+		lastID = batch[len(batch)-1].ImageID
+	}
+}
@@ -0,0 +1,80 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// EventAction is what pf_sync did to a listing
+type EventAction string
+
+const (
+	EventCreated      EventAction = "created"
+	EventUpdated      EventAction = "updated"
+	EventHidden       EventAction = "hidden"
+	EventImageAdded   EventAction = "image_added"
+	EventImageRemoved EventAction = "image_removed"
+	EventImageFailed  EventAction = "image_failed"
+	EventAgentMissing EventAction = "agent_missing"
+	// EventFailed is a listing that could not be saved
+	EventFailed EventAction = "failed"
+)
+
+// SyncEvent is one thing a run did to a listing
+type SyncEvent struct {
+	ID uint `gorm:"column:id;primaryKey"`
+	// RunID is the pf_sync_runs row, or 0 if the run was not recorded
+	RunID      uint        `gorm:"column:run_id;index"`
+	PfID       string      `gorm:"column:pf_id;index"`
+	PropertyID uint        `gorm:"column:property_id"`
+	Action     EventAction `gorm:"column:action"`
+	// Detail is the image path or URL the event is about, if any
+	Detail    string    `gorm:"column:detail"`
+	Error     string    `gorm:"column:error;type:text"`
+	CreatedAt time.Time `gorm:"column:created_at;index"`
+}
+
+func (SyncEvent) TableName() string {
+	return "pf_sync_events"
+}
+
+// RecordEvents stores events in one insert
+func RecordEvents(ctx context.Context, db *gorm.DB, events []SyncEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	if err := db.WithContext(ctx).Create(&events).Error; err != nil {
+		return fmt.Errorf("record sync events: %w", err)
+	}
+	return nil
+}
+
+// ListingEvent is a sync event with the command of its run
+type ListingEvent struct {
+	SyncEvent
+	Command string `gorm:"column:command"`
+}
+
+// ListingHistory returns the events of one listing, oldest first. A table
+// that does not exist yet gives no events.
+func ListingHistory(ctx context.Context, db *gorm.DB, pfID string) ([]ListingEvent, error) {
+	var events []ListingEvent
+	if !db.Migrator().HasTable(&SyncEvent{}) {
+		return events, nil
+	}
+
+	err := db.WithContext(ctx).
+		Table("pf_sync_events AS e").
+		Select("e.*, COALESCE(r.command, '') AS command").
+		Joins("LEFT JOIN pf_sync_runs r ON r.id = e.run_id").
+		Where("e.pf_id = ?", pfID).
+		Order("e.created_at, e.id").
+		Scan(&events).Error
+	if err != nil {
+		return nil, fmt.Errorf("load history of %s: %w", pfID, err)
+	}
+	return events, nil
+}
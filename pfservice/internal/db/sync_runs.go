@@ -0,0 +1,112 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"pfservice/internal/reporting"
+	"pfservice/internal/version"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RunStatus is the state of a command run in pf_sync_runs
+type RunStatus string
+
+const (
+	// RunRunning is left in place by a run that crashed
+	RunRunning   RunStatus = "running"
+	RunSucceeded RunStatus = "succeeded"
+	RunFailed    RunStatus = "failed"
+	// RunCompletedWithErrors is a run that finished but failed on some items
+	RunCompletedWithErrors RunStatus = "completed_with_errors"
+	// RunAborted is a run stopped by SIGINT/SIGTERM
+	RunAborted RunStatus = "aborted"
+)
+
+// CompletedStatus is the status of a run that finished with errorCount errors
+func CompletedStatus(errorCount int) RunStatus {
+	if errorCount > 0 {
+		return RunCompletedWithErrors
+	}
+	return RunSucceeded
+}
+
+// SyncRun is one run of a pf_* command
+type SyncRun struct {
+	ID         uint       `gorm:"column:id;primaryKey"`
+	Command    string     `gorm:"column:command;index"`
+	StartedAt  time.Time  `gorm:"column:started_at;index"`
+	FinishedAt *time.Time `gorm:"column:finished_at"`
+	Status     RunStatus  `gorm:"column:status;index"`
+
+	PropertiesCreated int  `gorm:"column:properties_created;not null;default:0"`
+	PropertiesUpdated int  `gorm:"column:properties_updated;not null;default:0"`
+	PropertiesHidden  int  `gorm:"column:properties_hidden;not null;default:0"`
+	ImagesDownloaded  int  `gorm:"column:images_downloaded;not null;default:0"`
+	ImagesRetired     int  `gorm:"column:images_retired;not null;default:0"`
+	UsersCreated      int  `gorm:"column:users_created;not null;default:0"`
+	UsersUpdated      int  `gorm:"column:users_updated;not null;default:0"`
+	Errors            int  `gorm:"column:errors;not null;default:0"`
+	Targeted          bool `gorm:"column:targeted;not null;default:false"`
+	Incremental       bool `gorm:"column:incremental;not null;default:false"`
+
+	// ErrorSummary says why a run failed, or what went wrong in a finished one
+	ErrorSummary string `gorm:"column:error_summary;type:text"`
+	// Version is the git version of the binary
+	Version string `gorm:"column:version"`
+}
+
+func (SyncRun) TableName() string {
+	return "pf_sync_runs"
+}
+
+// StartRun records that command started and returns the run to finish.
+// The table is created if needed, so commands that do not migrate can
+// record their runs too.
+func StartRun(ctx context.Context, db *gorm.DB, command string) (*SyncRun, error) {
+	if !db.Migrator().HasTable(&SyncRun{}) {
+		if err := db.WithContext(ctx).AutoMigrate(&SyncRun{}); err != nil {
+			return nil, fmt.Errorf("create run table: %w", err)
+		}
+	}
+
+	run := &SyncRun{
+		Command:   command,
+		StartedAt: time.Now().UTC(),
+		Status:    RunRunning,
+		Version:   version.String(),
+	}
+	if err := db.WithContext(ctx).Create(run).Error; err != nil {
+		return nil, fmt.Errorf("record run start: %w", err)
+	}
+	return run, nil
+}
+
+// FinishRun records the end of run with its status and counters.
+// A nil run, one that failed to start, is ignored.
+func FinishRun(ctx context.Context, db *gorm.DB, run *SyncRun, status RunStatus, stats reporting.ReportStats, errorSummary string) error {
+	if run == nil {
+		return nil
+	}
+
+	finishedAt := time.Now().UTC()
+	run.FinishedAt = &finishedAt
+	run.Status = status
+	run.PropertiesCreated = stats.PropertiesCreated
+	run.PropertiesUpdated = stats.PropertiesUpdated
+	run.PropertiesHidden = stats.PropertiesHidden
+	run.ImagesDownloaded = stats.ImagesDownloaded
+	run.ImagesRetired = stats.ImagesRetired
+	run.UsersCreated = stats.UsersCreated
+	run.UsersUpdated = stats.UsersUpdated
+	run.Errors = stats.Errors
+	run.Targeted = stats.Targeted
+	run.Incremental = stats.Incremental
+	run.ErrorSummary = errorSummary
+
+	if err := db.WithContext(ctx).Save(run).Error; err != nil {
+		return fmt.Errorf("record run %d finish: %w", run.ID, err)
+	}
+	return nil
+}
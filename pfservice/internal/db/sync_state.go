@@ -0,0 +1,74 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SyncState is the sync watermark of one Property Finder account
+type SyncState struct {
+	Account string `gorm:"column:account;primaryKey"`
+	// LastSyncedAt is when the last complete run started; the next
+	// incremental run asks for listings updated since then
+	LastSyncedAt *time.Time `gorm:"column:last_synced_at"`
+	// LastFullSyncAt is when the last complete full run started
+	LastFullSyncAt *time.Time `gorm:"column:last_full_sync_at"`
+	UpdatedAt      time.Time  `gorm:"column:updated_at"`
+}
+
+func (SyncState) TableName() string {
+	return "pf_sync_state"
+}
+
+// IncrementalSince returns the watermark to sync from, or false when the run
+// must be a full one: there is no watermark yet, fullInterval is 0, or the
+// last full run is fullInterval or more ago.
+func (s SyncState) IncrementalSince(fullInterval time.Duration, now time.Time) (time.Time, bool) {
+	if s.LastSyncedAt == nil || s.LastFullSyncAt == nil || fullInterval <= 0 {
+		return time.Time{}, false
+	}
+	if now.Sub(*s.LastFullSyncAt) >= fullInterval {
+		return time.Time{}, false
+	}
+	return *s.LastSyncedAt, true
+}
+
+// GetSyncState returns the sync state of account. An account that has never
+// synced, or a table that does not exist yet, gives an empty state.
+func GetSyncState(ctx context.Context, db *gorm.DB, account string) (SyncState, error) {
+	state := SyncState{Account: account}
+	if !db.Migrator().HasTable(&SyncState{}) {
+		return state, nil
+	}
+
+	err := db.WithContext(ctx).Where("account = ?", account).First(&state).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return state, fmt.Errorf("load sync state: %w", err)
+	}
+	return state, nil
+}
+
+// SaveSyncState records a complete run that started at startedAt. A full run
+// also moves the full sync watermark.
+func SaveSyncState(ctx context.Context, db *gorm.DB, account string, startedAt time.Time, full bool) error {
+	state := SyncState{Account: account, LastSyncedAt: &startedAt}
+	columns := []string{"last_synced_at", "updated_at"}
+	if full {
+		state.LastFullSyncAt = &startedAt
+		columns = append(columns, "last_full_sync_at")
+	}
+
+	err := db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "account"}},
+		DoUpdates: clause.AssignmentColumns(columns),
+	}).Create(&state).Error
+	if err != nil {
+		return fmt.Errorf("save sync state: %w", err)
+	}
+	return nil
+}
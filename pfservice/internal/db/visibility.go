@@ -0,0 +1,59 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// HiddenNotListed is the reason recorded for properties hidden because their
+// listing was missing from a complete listings fetch
+const HiddenNotListed = "not listed on Property Finder"
+
+// PropertyVisibility records when and why pf_sync hid a property. It lives in
+// its own table so the Django schema is unchanged, and updated_at on the
+// property no longer tells when it was hidden after a later update.
+// The row is removed when the property is shown again.
+type PropertyVisibility struct {
+	PropertyID   uint      `gorm:"column:property_id;primaryKey;autoIncrement:false"`
+	HiddenAt     time.Time `gorm:"column:hidden_at;not null;index"`
+	HiddenReason string    `gorm:"column:hidden_reason"`
+	// HiddenRunID is the pf_sync_runs row, or 0 if the run was not recorded
+	HiddenRunID uint `gorm:"column:hidden_run_id"`
+}
+
+func (PropertyVisibility) TableName() string {
+	return "pf_property_visibility"
+}
+
+// recordHidden stores the hide time and reason of propertyIDs
+func recordHidden(db *gorm.DB, propertyIDs []uint, reason string, runID uint, at time.Time) error {
+	rows := make([]PropertyVisibility, 0, len(propertyIDs))
+	for _, propertyID := range propertyIDs {
+		rows = append(rows, PropertyVisibility{
+			PropertyID:   propertyID,
+			HiddenAt:     at,
+			HiddenReason: reason,
+			HiddenRunID:  runID,
+		})
+	}
+
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "property_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"hidden_at", "hidden_reason", "hidden_run_id"}),
+	}).Create(&rows).Error
+	if err != nil {
+		return fmt.Errorf("record hidden properties: %w", err)
+	}
+	return nil
+}
+
+// clearHidden removes the hide record of a property that is visible again
+func clearHidden(db *gorm.DB, propertyID uint) error {
+	if err := db.Where("property_id = ?", propertyID).Delete(&PropertyVisibility{}).Error; err != nil {
+		return fmt.Errorf("clear hidden state of property %d: %w", propertyID, err)
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package httpclient
+
+import (
+	"context"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"pfservice/config"
+
+	"github.com/go-resty/resty/v2"
+)
+
+const (
+	defaultTimeout       = 30 * time.Second
+	defaultRetryDelay    = 1 * time.Second
+	defaultRetryMaxDelay = 30 * time.Second
+
+	// Upper bound on how long we honor a Retry-After header
+	maxRetryAfter = 2 * time.Minute
+)
+
+// RetryPolicy controls how failed requests are retried.
+// Network errors, 5xx and 429 responses are retried with exponential backoff and jitter.
+type RetryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+// backoff returns the wait before retry number attempt (0-based)
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 0; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	// Equal jitter: half fixed, half random
+	half := delay / 2
+	return half + rand.N(delay-half+1)
+}
+
+// Client talks to the Property Finder API.
+// A single client should be shared by a command so the token cache and
+// connection pool are reused across calls.
+type Client struct {
+	BaseURL   string
+	APIKey    string
+	APISecret string
+	Timeout   time.Duration
+	Retry     RetryPolicy
+
+	// ListingsPageSize and ListingsMaxPages configure NewListingPager
+	ListingsPageSize int
+	ListingsMaxPages int
+
+	http   *resty.Client
+	tokens *TokenManager
+}
+
+// NewClient creates an API client from the application config
+func NewClient(cfg *config.Config) *Client {
+	c := &Client{
+		BaseURL:   cfg.PFAPIUrl,
+		APIKey:    cfg.PFAPIKey,
+		APISecret: cfg.PFAPISecret,
+		Timeout:   cfg.PFAPITimeout,
+		Retry: RetryPolicy{
+			MaxRetries: cfg.PFAPIMaxRetries,
+			BaseDelay:  cfg.PFAPIRetryDelay,
+			MaxDelay:   cfg.PFAPIRetryMaxDelay,
+		},
+		ListingsPageSize: cfg.ListingsPageSize,
+		ListingsMaxPages: cfg.ListingsMaxPages,
+	}
+
+	if c.Timeout <= 0 {
+		c.Timeout = defaultTimeout
+	}
+	if c.Retry.MaxRetries < 0 {
+		c.Retry.MaxRetries = 0
+	}
+	if c.Retry.BaseDelay <= 0 {
+		c.Retry.BaseDelay = defaultRetryDelay
+	}
+	if c.Retry.MaxDelay <= 0 {
+		c.Retry.MaxDelay = defaultRetryMaxDelay
+	}
+	if c.ListingsPageSize <= 0 {
+		c.ListingsPageSize = defaultListingsPageSize
+	}
+	if c.ListingsMaxPages <= 0 {
+		c.ListingsMaxPages = defaultListingsMaxPages
+	}
+
+	c.http = resty.New().SetTimeout(c.Timeout)
+	c.tokens = &TokenManager{
+		fetch: c.RequestToken,
+		now:   time.Now,
+	}
+
+	return c
+}
+
+// Token returns the cached access token, authenticating if needed
+func (c *Client) Token(ctx context.Context) (string, error) {
+	return c.tokens.Token(ctx)
+}
+
+// do sends a request to path, retrying network errors, 5xx and 429 responses.
+// Authenticated requests get the bearer token and are retried once with a
+// fresh token when the API answers 401.
+// Cancelling ctx aborts the request in flight and any pending retry wait.
+func (c *Client) do(ctx context.Context, method, path string, auth bool, build func(r *resty.Request)) (*resty.Response, error) {
+	reauthenticated := false
+	attempt := 0
+
+	for {
+		req := c.http.R().SetContext(ctx).SetHeader("X-PF-Client", c.APIKey)
+		build(req)
+
+		if auth {
+			token, err := c.tokens.Token(ctx)
+			if err != nil {
+				return nil, err
+			}
+			req.SetHeader("Authorization", "Bearer "+token)
+		}
+
+		res, err := req.Execute(method, c.BaseURL+path)
+
+		var wait time.Duration
+		switch {
+		case ctx.Err() != nil:
+			return nil, ctx.Err()
+		case err != nil:
+			wait = c.Retry.backoff(attempt)
+		case res.StatusCode() == http.StatusUnauthorized && auth && !reauthenticated:
+			reauthenticated = true
+			c.tokens.Invalidate()
+			continue
+		case res.StatusCode() == http.StatusTooManyRequests:
+			wait = retryAfter(res)
+			if wait < 0 {
+				wait = c.Retry.backoff(attempt)
+			}
+		case res.StatusCode() >= 500:
+			wait = c.Retry.backoff(attempt)
+		default:
+			return res, nil
+		}
+
+		if attempt >= c.Retry.MaxRetries {
+			return res, err
+		}
+		attempt++
+
+		if err != nil {
+			log.Printf("PF API %s %s failed: %v. Retry %d/%d in %v", method, path, err, attempt, c.Retry.MaxRetries, wait)
+		} else {
+			log.Printf("PF API %s %s returned %d. Retry %d/%d in %v", method, path, res.StatusCode(), attempt, c.Retry.MaxRetries, wait)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// retryAfter parses the Retry-After header of a 429 response.
+// It returns -1 if the header is missing or invalid.
+func retryAfter(res *resty.Response) time.Duration {
+	value := res.Header().Get("Retry-After")
+	if value == "" {
+		return -1
+	}
+
+	var wait time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		wait = time.Duration(seconds) * time.Second
+	} else if at, err := http.ParseTime(value); err == nil {
+		wait = time.Until(at)
+	} else {
+		return -1
+	}
+
+	if wait < 0 {
+		wait = 0
+	}
+	if wait > maxRetryAfter {
+		wait = maxRetryAfter
+	}
+	return wait
+}
@@ -0,0 +1,152 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"pfservice/config"
+)
+
+func newTestClient(url string, maxRetries int) *Client {
+	client := NewClient(&config.Config{PFAPIUrl: url, PFAPIKey: "test-api-key"})
+	client.Retry = RetryPolicy{
+		MaxRetries: maxRetries,
+		BaseDelay:  time.Millisecond,
+		MaxDelay:   5 * time.Millisecond,
+	}
+	return client
+}
+
+func TestClientRetriesServerErrors(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"accessToken":"token","expiresIn":3600}`))
+	}))
+	defer server.Close()
+
+	token, err := newTestClient(server.URL, 3).RequestToken(context.Background())
+	if err != nil {
+		t.Fatalf("Expected success after retries: %v", err)
+	}
+	if token.AccessToken != "token" {
+		t.Errorf("Expected token 'token', got '%s'", token.AccessToken)
+	}
+	if attempts != 3 {
+		t.Errorf("Expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestClientGivesUpAfterMaxRetries(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	if _, err := newTestClient(server.URL, 2).RequestToken(context.Background()); err == nil {
+		t.Error("Expected error after all retries failed")
+	}
+	if attempts != 3 {
+		t.Errorf("Expected 1 attempt + 2 retries, got %d", attempts)
+	}
+}
+
+func TestClientDoesNotRetryClientErrors(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	if _, err := newTestClient(server.URL, 3).RequestToken(context.Background()); err == nil {
+		t.Error("Expected error for 400 response")
+	}
+	if attempts != 1 {
+		t.Errorf("Expected a single attempt for 400, got %d", attempts)
+	}
+}
+
+func TestClientHonorsRetryAfter(t *testing.T) {
+	var times []time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		times = append(times, time.Now())
+		if len(times) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"accessToken":"token","expiresIn":3600}`))
+	}))
+	defer server.Close()
+
+	if _, err := newTestClient(server.URL, 3).RequestToken(context.Background()); err != nil {
+		t.Fatalf("Expected success after 429: %v", err)
+	}
+	if len(times) != 2 {
+		t.Fatalf("Expected 2 attempts, got %d", len(times))
+	}
+	if gap := times[1].Sub(times[0]); gap < time.Second {
+		t.Errorf("Expected to wait Retry-After (1s), waited %v", gap)
+	}
+}
+
+func TestClientRetriesNetworkErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := server.URL
+	server.Close()
+
+	start := time.Now()
+	if _, err := newTestClient(url, 2).RequestToken(context.Background()); err == nil {
+		t.Error("Expected error for closed server")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("Retries against a closed server took too long: %v", time.Since(start))
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	for attempt := 0; attempt < 10; attempt++ {
+		delay := policy.backoff(attempt)
+		expected := policy.BaseDelay << attempt
+		if expected > policy.MaxDelay || expected <= 0 {
+			expected = policy.MaxDelay
+		}
+		if delay < expected/2 || delay > expected {
+			t.Errorf("Attempt %d: delay %v outside [%v, %v]", attempt, delay, expected/2, expected)
+		}
+	}
+}
+
+func TestClientStopsRetryingWhenCancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := newTestClient(server.URL, 3).RequestToken(ctx)
+	if err == nil {
+		t.Error("Expected error when context is cancelled")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("Cancelled request should return promptly, took %v", time.Since(start))
+	}
+}
@@ -1,33 +1,55 @@
 package httpclient
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"pfservice/config"
+	"net/http"
+	"net/url"
 	"pfservice/internal/property"
+	"time"
 
 	"github.com/go-resty/resty/v2"
 )
 
+// Pagination is the paging metadata returned alongside listing results
+type Pagination struct {
+	Total      int  `json:"total"`
+	Page       int  `json:"page"`
+	PerPage    int  `json:"perPage"`
+	TotalPages int  `json:"totalPages"`
+	NextPage   *int `json:"nextPage"`
+	PrevPage   *int `json:"prevPage"`
+}
+
+// ErrListingNotFound is returned when the API has no listing with the
+// requested ID or reference
+var ErrListingNotFound = errors.New("listing not found")
+
 type ListingsResponse struct {
-	Results []property.PFListing `json:"results"`
+	Results    []property.PFListing `json:"results"`
+	Pagination Pagination           `json:"pagination"`
 }
 
-func FetchListings(token string, page int) (*ListingsResponse, error) {
-	client := resty.New()
+func (c *Client) FetchListings(ctx context.Context, page int, perPage int) (*ListingsResponse, error) {
+	return c.FetchListingsUpdatedSince(ctx, page, perPage, time.Time{})
+}
 
+// FetchListingsUpdatedSince fetches a page of the listings updated at or after
+// since. A zero since fetches every listing.
+func (c *Client) FetchListingsUpdatedSince(ctx context.Context, page int, perPage int, since time.Time) (*ListingsResponse, error) {
 	var resp ListingsResponse
 
-	res, err := client.R().
-		SetHeaders(map[string]string{
-			"Authorization": "Bearer " + token,
-			"X-PF-Client":   config.AppConfig.PFAPIKey,
-		}).
-		SetQueryParams(map[string]string{
+	res, err := c.do(ctx, http.MethodGet, "/listings", true, func(r *resty.Request) {
+		r.SetQueryParams(map[string]string{
 			"page":    fmt.Sprintf("%d", page),
-			"perPage": "50",
+			"perPage": fmt.Sprintf("%d", perPage),
 		}).
-		SetResult(&resp).
-		Get(config.AppConfig.PFAPIUrl + "/listings")
+			SetResult(&resp)
+		if !since.IsZero() {
+			r.SetQueryParam("filter[updatedAt][from]", since.UTC().Format(time.RFC3339))
+		}
+	})
 
 	if err != nil {
 		return nil, err
@@ -38,7 +60,7 @@ func FetchListings(token string, page int) (*ListingsResponse, error) {
 	}
 
 	// Debug: Log first listing's media structure to understand API response
-	if len(resp.Results) > 0 {
+	if page == 1 && len(resp.Results) > 0 {
 		firstListing := resp.Results[0]
 		fmt.Printf("DEBUG: First listing ID: %s\n", firstListing.ID)
 		fmt.Printf("DEBUG: Media.Images count: %d\n", len(firstListing.Media.Images))
@@ -58,3 +80,59 @@ func FetchListings(token string, page int) (*ListingsResponse, error) {
 
 	return &resp, nil
 }
+
+// FetchListing fetches a single listing by its Property Finder ID
+func (c *Client) FetchListing(ctx context.Context, id string) (*property.PFListing, error) {
+	var listing property.PFListing
+
+	res, err := c.do(ctx, http.MethodGet, "/listings/"+url.PathEscape(id), true, func(r *resty.Request) {
+		r.SetResult(&listing)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode() == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrListingNotFound, id)
+	}
+	if res.StatusCode() >= 300 {
+		return nil, fmt.Errorf("listing API error: status %d, body: %s", res.StatusCode(), res.String())
+	}
+	if listing.ID == "" {
+		return nil, fmt.Errorf("%w: %s", ErrListingNotFound, id)
+	}
+
+	return &listing, nil
+}
+
+// FetchListingByReference fetches the listing with the given reference.
+// The reference is matched exactly; the API filter alone is not trusted.
+func (c *Client) FetchListingByReference(ctx context.Context, reference string) (*property.PFListing, error) {
+	var resp ListingsResponse
+
+	res, err := c.do(ctx, http.MethodGet, "/listings", true, func(r *resty.Request) {
+		r.SetQueryParams(map[string]string{
+			"filter[reference]": reference,
+			"page":              "1",
+			"perPage":           fmt.Sprintf("%d", defaultListingsPageSize),
+		}).
+			SetResult(&resp)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode() >= 300 {
+		return nil, fmt.Errorf("listings API error: status %d, body: %s", res.StatusCode(), res.String())
+	}
+
+	for i := range resp.Results {
+		if resp.Results[i].Reference == reference {
+			return &resp.Results[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: reference %s", ErrListingNotFound, reference)
+}
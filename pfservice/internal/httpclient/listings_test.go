@@ -0,0 +1,84 @@
+package httpclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"pfservice/config"
+	"pfservice/internal/property"
+)
+
+// newSingleListingServer serves the listings in byID from /listings/{id} and
+// answers reference filters on /listings
+func newSingleListingServer(t *testing.T, byID map[string]property.PFListing) *Client {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/auth/token" {
+			json.NewEncoder(w).Encode(TokenResponse{AccessToken: "token", ExpiresIn: 3600})
+			return
+		}
+		if r.URL.Path == "/listings" {
+			// Loose match like a prefix search, so the client must check
+			ref := r.URL.Query().Get("filter[reference]")
+			resp := ListingsResponse{}
+			for _, listing := range byID {
+				if len(ref) > 0 && len(listing.Reference) >= len(ref) && listing.Reference[:len(ref)] == ref {
+					resp.Results = append(resp.Results, listing)
+				}
+			}
+			json.NewEncoder(w).Encode(resp)
+			return
+		}
+
+		listing, ok := byID[r.URL.Path[len("/listings/"):]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(listing)
+	}))
+	t.Cleanup(server.Close)
+
+	return NewClient(&config.Config{PFAPIUrl: server.URL})
+}
+
+func TestFetchListing(t *testing.T) {
+	client := newSingleListingServer(t, map[string]property.PFListing{
+		"listing-1": {ID: "listing-1", Reference: "REF-1"},
+	})
+
+	listing, err := client.FetchListing(context.Background(), "listing-1")
+	if err != nil {
+		t.Fatalf("FetchListing failed: %v", err)
+	}
+	if listing.ID != "listing-1" {
+		t.Errorf("Expected listing-1, got %s", listing.ID)
+	}
+
+	if _, err := client.FetchListing(context.Background(), "listing-2"); !errors.Is(err, ErrListingNotFound) {
+		t.Errorf("Expected ErrListingNotFound, got %v", err)
+	}
+}
+
+func TestFetchListingByReference(t *testing.T) {
+	client := newSingleListingServer(t, map[string]property.PFListing{
+		"listing-1": {ID: "listing-1", Reference: "REF-10"},
+		"listing-2": {ID: "listing-2", Reference: "REF-1"},
+	})
+
+	listing, err := client.FetchListingByReference(context.Background(), "REF-1")
+	if err != nil {
+		t.Fatalf("FetchListingByReference failed: %v", err)
+	}
+	if listing.ID != "listing-2" {
+		t.Errorf("Expected the exact reference match listing-2, got %s", listing.ID)
+	}
+
+	if _, err := client.FetchListingByReference(context.Background(), "REF-2"); !errors.Is(err, ErrListingNotFound) {
+		t.Errorf("Expected ErrListingNotFound, got %v", err)
+	}
+}
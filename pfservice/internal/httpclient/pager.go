@@ -0,0 +1,98 @@
+package httpclient
+
+import (
+	"context"
+	"time"
+
+	"pfservice/internal/property"
+)
+
+const (
+	defaultListingsPageSize = 50
+	defaultListingsMaxPages = 100
+)
+
+// ListingPager walks the listings endpoint page by page.
+// It stops on the last page reported by the API pagination metadata,
+// or after MaxPages pages as a safety cap.
+type ListingPager struct {
+	PageSize int
+	MaxPages int
+	// UpdatedSince limits the pages to listings updated since then, if set
+	UpdatedSince time.Time
+
+	client   *Client
+	page     int
+	done     bool
+	complete bool
+	total    int
+}
+
+// NewListingPager creates a pager using the client's page size and page cap
+func (c *Client) NewListingPager() *ListingPager {
+	return &ListingPager{
+		PageSize: c.ListingsPageSize,
+		MaxPages: c.ListingsMaxPages,
+		client:   c,
+	}
+}
+
+// Next fetches the next page of listings.
+// It returns (nil, nil) once there are no more pages to read.
+func (p *ListingPager) Next(ctx context.Context) ([]property.PFListing, error) {
+	if p.done {
+		return nil, nil
+	}
+
+	if p.page >= p.MaxPages {
+		p.done = true
+		return nil, nil
+	}
+
+	resp, err := p.client.FetchListingsUpdatedSince(ctx, p.page+1, p.PageSize, p.UpdatedSince)
+	if err != nil {
+		p.done = true
+		return nil, err
+	}
+	p.page++
+
+	meta := resp.Pagination
+	if meta.Total > 0 {
+		p.total = meta.Total
+	}
+
+	switch {
+	case len(resp.Results) == 0:
+		// Nothing left regardless of what the metadata says
+		p.done = true
+		p.complete = true
+		return nil, nil
+	case meta.TotalPages > 0:
+		if p.page >= meta.TotalPages {
+			p.done = true
+			p.complete = true
+		}
+	case meta.NextPage == nil && meta.Page > 0:
+		// API sent metadata without totalPages, rely on nextPage
+		p.done = true
+		p.complete = true
+	}
+
+	return resp.Results, nil
+}
+
+// Page returns the number of the last page fetched
+func (p *ListingPager) Page() int {
+	return p.page
+}
+
+// Total returns the total number of listings reported by the API, if known
+func (p *ListingPager) Total() int {
+	return p.total
+}
+
+// Complete reports whether every page was read.
+// It is false if the pager stopped on an error or on the MaxPages cap.
+func (p *ListingPager) Complete() bool {
+	return p.complete
+}
@@ -0,0 +1,213 @@
+package httpclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"pfservice/config"
+	"pfservice/internal/property"
+)
+
+// newListingsServer serves totalListings listings using the API pagination format
+func newListingsServer(t *testing.T, totalListings int, withMeta bool) (*Client, *int) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/auth/token" {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(TokenResponse{AccessToken: "token", ExpiresIn: 3600})
+			return
+		}
+		if r.URL.Path != "/listings" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		requests++
+
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		perPage, _ := strconv.Atoi(r.URL.Query().Get("perPage"))
+		totalPages := (totalListings + perPage - 1) / perPage
+
+		resp := ListingsResponse{}
+		for i := (page - 1) * perPage; i < page*perPage && i < totalListings; i++ {
+			resp.Results = append(resp.Results, property.PFListing{ID: fmt.Sprintf("listing-%d", i)})
+		}
+		if withMeta {
+			resp.Pagination = Pagination{
+				Total:      totalListings,
+				Page:       page,
+				PerPage:    perPage,
+				TotalPages: totalPages,
+			}
+			if page < totalPages {
+				next := page + 1
+				resp.Pagination.NextPage = &next
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+
+	t.Cleanup(server.Close)
+
+	return NewClient(&config.Config{PFAPIUrl: server.URL}), &requests
+}
+
+func collectListings(t *testing.T, pager *ListingPager) []property.PFListing {
+	var all []property.PFListing
+	for {
+		listings, err := pager.Next(context.Background())
+		if err != nil {
+			t.Fatalf("Unexpected pager error: %v", err)
+		}
+		if listings == nil {
+			return all
+		}
+		all = append(all, listings...)
+	}
+}
+
+func TestListingPagerUsesPaginationMetadata(t *testing.T) {
+	client, requests := newListingsServer(t, 25, true)
+
+	pager := client.NewListingPager()
+	pager.PageSize = 10
+
+	all := collectListings(t, pager)
+	if len(all) != 25 {
+		t.Errorf("Expected 25 listings, got %d", len(all))
+	}
+	// The last page is detected from totalPages, so no extra empty request
+	if *requests != 3 {
+		t.Errorf("Expected 3 requests, got %d", *requests)
+	}
+	if !pager.Complete() {
+		t.Error("Pager should report a complete fetch")
+	}
+	if pager.Total() != 25 {
+		t.Errorf("Expected total 25, got %d", pager.Total())
+	}
+}
+
+func TestListingPagerFullLastPage(t *testing.T) {
+	// A full last page must not be mistaken for "more pages to come"
+	client, requests := newListingsServer(t, 20, true)
+
+	pager := client.NewListingPager()
+	pager.PageSize = 10
+
+	all := collectListings(t, pager)
+	if len(all) != 20 {
+		t.Errorf("Expected 20 listings, got %d", len(all))
+	}
+	if *requests != 2 {
+		t.Errorf("Expected 2 requests, got %d", *requests)
+	}
+}
+
+func TestListingPagerWithoutMetadata(t *testing.T) {
+	client, requests := newListingsServer(t, 15, false)
+
+	pager := client.NewListingPager()
+	pager.PageSize = 10
+
+	all := collectListings(t, pager)
+	if len(all) != 15 {
+		t.Errorf("Expected 15 listings, got %d", len(all))
+	}
+	// Without metadata the pager reads until it gets an empty page
+	if *requests != 3 {
+		t.Errorf("Expected 3 requests, got %d", *requests)
+	}
+	if !pager.Complete() {
+		t.Error("Pager should report a complete fetch")
+	}
+}
+
+func TestListingPagerMaxPages(t *testing.T) {
+	client, requests := newListingsServer(t, 100, true)
+
+	pager := client.NewListingPager()
+	pager.PageSize = 10
+	pager.MaxPages = 3
+
+	all := collectListings(t, pager)
+	if len(all) != 30 {
+		t.Errorf("Expected 30 listings, got %d", len(all))
+	}
+	if *requests != 3 {
+		t.Errorf("Expected 3 requests, got %d", *requests)
+	}
+	if pager.Complete() {
+		t.Error("Pager stopped by MaxPages should not report a complete fetch")
+	}
+}
+
+func TestListingPagerError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	client := NewClient(&config.Config{PFAPIUrl: server.URL})
+
+	pager := client.NewListingPager()
+	if _, err := pager.Next(context.Background()); err == nil {
+		t.Error("Expected error for failing listings endpoint")
+	}
+	if pager.Complete() {
+		t.Error("Pager should not report a complete fetch after an error")
+	}
+}
+
+func TestListingPagerUpdatedSince(t *testing.T) {
+	var filters []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/auth/token" {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(TokenResponse{AccessToken: "token", ExpiresIn: 3600})
+			return
+		}
+		filters = append(filters, r.URL.Query().Get("filter[updatedAt][from]"))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ListingsResponse{})
+	}))
+	defer server.Close()
+
+	client := NewClient(&config.Config{PFAPIUrl: server.URL})
+
+	pager := client.NewListingPager()
+	collectListings(t, pager)
+
+	pager = client.NewListingPager()
+	pager.UpdatedSince = time.Date(2026, 3, 1, 4, 30, 0, 0, time.FixedZone("UZT", 5*3600))
+	collectListings(t, pager)
+
+	if len(filters) != 2 {
+		t.Fatalf("Expected 2 listings requests, got %d", len(filters))
+	}
+	if filters[0] != "" {
+		t.Errorf("Full fetch should not filter by updatedAt, got %q", filters[0])
+	}
+	if filters[1] != "2026-02-28T23:30:00Z" {
+		t.Errorf("Expected the watermark in UTC, got %q", filters[1])
+	}
+}
+
+func TestListingPagerUsesClientConfig(t *testing.T) {
+	pager := NewClient(&config.Config{ListingsPageSize: 25, ListingsMaxPages: 4}).NewListingPager()
+	if pager.PageSize != 25 || pager.MaxPages != 4 {
+		t.Errorf("Expected page size 25 and 4 pages from the client config, got %d and %d", pager.PageSize, pager.MaxPages)
+	}
+
+	pager = NewClient(&config.Config{}).NewListingPager()
+	if pager.PageSize != defaultListingsPageSize || pager.MaxPages != defaultListingsMaxPages {
+		t.Errorf("Expected default page size and cap, got %d and %d", pager.PageSize, pager.MaxPages)
+	}
+}
@@ -1,38 +1,98 @@
 package httpclient
 
 import (
+	"context"
 	"fmt"
-    "pfservice/config"
+	"net/http"
+	"sync"
+	"time"
 
-    "github.com/go-resty/resty/v2"
+	"github.com/go-resty/resty/v2"
+)
+
+const (
+	// Refresh the token this long before the API says it expires
+	tokenRefreshMargin = 60 * time.Second
+	// Lifetime assumed when the API does not send expiresIn
+	defaultTokenLifetime = 15 * time.Minute
 )
 
 type TokenResponse struct {
-    AccessToken string `json:"accessToken"`
-    ExpiresIn   int    `json:"expiresIn"`
+	AccessToken string `json:"accessToken"`
+	ExpiresIn   int    `json:"expiresIn"`
 }
 
-func GetJWTToken() (string, error) {
-	client := resty.New()
-
+// RequestToken authenticates with the API key/secret and returns the full token response
+func (c *Client) RequestToken(ctx context.Context) (*TokenResponse, error) {
 	var resp TokenResponse
-	r, err := client.R().
-		SetHeader("Content-Type", "application/json").
-		SetHeader("X-PF-Client", config.AppConfig.PFAPIKey).
-		SetBody(map[string]string{
-			"apiKey":    config.AppConfig.PFAPIKey,
-			"apiSecret": config.AppConfig.PFAPISecret,
-		}).
-		SetResult(&resp).
-		Post(config.AppConfig.PFAPIUrl + "/auth/token")
+
+	r, err := c.do(ctx, http.MethodPost, "/auth/token", false, func(r *resty.Request) {
+		r.SetHeader("Content-Type", "application/json").
+			SetBody(map[string]string{
+				"apiKey":    c.APIKey,
+				"apiSecret": c.APISecret,
+			}).
+			SetResult(&resp)
+	})
 
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	if r.StatusCode() >= 300 {
-		return "", fmt.Errorf("token error: %s", r.String())
+		return nil, fmt.Errorf("token error: %s", r.String())
+	}
+
+	return &resp, nil
+}
+
+// TokenManager caches the access token and refreshes it shortly before it expires.
+// It is safe for concurrent use.
+type TokenManager struct {
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+
+	fetch func(ctx context.Context) (*TokenResponse, error)
+	now   func() time.Time
+}
+
+// Token returns the cached token, requesting a new one if it is missing or about to expire
+func (m *TokenManager) Token(ctx context.Context) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.token != "" && m.now().Before(m.expiresAt) {
+		return m.token, nil
 	}
 
-	return resp.AccessToken, nil
+	resp, err := m.fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	lifetime := time.Duration(resp.ExpiresIn) * time.Second
+	if lifetime <= 0 {
+		lifetime = defaultTokenLifetime
+	}
+
+	// Keep a margin before expiry, but never more than half the lifetime
+	margin := tokenRefreshMargin
+	if margin > lifetime/2 {
+		margin = lifetime / 2
+	}
+
+	m.token = resp.AccessToken
+	m.expiresAt = m.now().Add(lifetime - margin)
+
+	return m.token, nil
+}
+
+// Invalidate drops the cached token so the next call to Token re-authenticates
+func (m *TokenManager) Invalidate() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.token = ""
+	m.expiresAt = time.Time{}
 }
@@ -0,0 +1,104 @@
+package httpclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"pfservice/config"
+)
+
+func TestTokenManagerCachesToken(t *testing.T) {
+	calls := 0
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tm := &TokenManager{
+		fetch: func(ctx context.Context) (*TokenResponse, error) {
+			calls++
+			return &TokenResponse{AccessToken: "token", ExpiresIn: 600}, nil
+		},
+		now: func() time.Time { return now },
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := tm.Token(context.Background()); err != nil {
+			t.Fatalf("Unexpected token error: %v", err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Expected 1 token request, got %d", calls)
+	}
+
+	// Still valid just before the refresh margin
+	now = now.Add(600*time.Second - tokenRefreshMargin - time.Second)
+	tm.Token(context.Background())
+	if calls != 1 {
+		t.Errorf("Token should still be cached, got %d requests", calls)
+	}
+
+	// Inside the refresh margin a new token is requested
+	now = now.Add(2 * time.Second)
+	tm.Token(context.Background())
+	if calls != 2 {
+		t.Errorf("Token should be refreshed before expiry, got %d requests", calls)
+	}
+}
+
+func TestTokenManagerInvalidate(t *testing.T) {
+	calls := 0
+	tm := &TokenManager{
+		fetch: func(ctx context.Context) (*TokenResponse, error) {
+			calls++
+			return &TokenResponse{AccessToken: "token", ExpiresIn: 3600}, nil
+		},
+		now: time.Now,
+	}
+
+	tm.Token(context.Background())
+	tm.Invalidate()
+	tm.Token(context.Background())
+	if calls != 2 {
+		t.Errorf("Expected 2 token requests after invalidate, got %d", calls)
+	}
+}
+
+func TestFetchAllUsersRetriesOnUnauthorized(t *testing.T) {
+	tokenRequests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/auth/token":
+			tokenRequests++
+			token := "expired-token"
+			if tokenRequests > 1 {
+				token = "fresh-token"
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(TokenResponse{AccessToken: token, ExpiresIn: 3600})
+		case "/users":
+			if r.Header.Get("Authorization") != "Bearer fresh-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"data":[{"id":1,"email":"agent@example.com"}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(&config.Config{PFAPIUrl: server.URL})
+
+	users, err := client.FetchAllUsers(context.Background())
+	if err != nil {
+		t.Fatalf("Expected retry with fresh token to succeed: %v", err)
+	}
+	if len(users) != 1 {
+		t.Errorf("Expected 1 user, got %d", len(users))
+	}
+	if tokenRequests != 2 {
+		t.Errorf("Expected 2 token requests, got %d", tokenRequests)
+	}
+}
@@ -1,27 +1,24 @@
 package httpclient
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 	"pfservice/internal/users"
 
 	"github.com/go-resty/resty/v2"
-	"pfservice/config"
 )
 
 type PFUsersResponse struct {
 	Data []users.PFUser `json:"data"`
 }
 
-func FetchAllUsers(token string) ([]users.PFUser, error) {
-	client := resty.New()
-
+func (c *Client) FetchAllUsers(ctx context.Context) ([]users.PFUser, error) {
 	var resp PFUsersResponse
 
-	r, err := client.R().
-		SetHeader("Authorization", "Bearer "+token).
-		SetHeader("X-PF-Client", config.AppConfig.PFAPIKey).
-		SetResult(&resp).
-		Get(config.AppConfig.PFAPIUrl + "/users")
+	r, err := c.do(ctx, http.MethodGet, "/users", true, func(r *resty.Request) {
+		r.SetResult(&resp)
+	})
 
 	if err != nil {
 		return nil, err
@@ -33,4 +30,3 @@ func FetchAllUsers(token string) ([]users.PFUser, error) {
 
 	return resp.Data, nil
 }
-
@@ -0,0 +1,115 @@
+package media
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Downloads are written to a temp file with this prefix next to their final
+// path and renamed into place once complete
+const tempFilePrefix = ".pf-tmp-"
+
+// TempFileMaxAge is how old a temp file must be before SweepTempFiles removes it,
+// so downloads in flight in another process are left alone
+const TempFileMaxAge = time.Hour
+
+// writeFileAtomic writes data to fullPath through a synced temp file in the same
+// directory, so fullPath is either absent or complete, even if the process dies
+func writeFileAtomic(fullPath string, data []byte) error {
+	dir := filepath.Dir(fullPath)
+	tmp, err := os.CreateTemp(dir, tempFilePrefix+"*")
+	if err != nil {
+		return fmt.Errorf("create temp file in %s: %w", dir, err)
+	}
+	tmpPath := tmp.Name()
+
+	// Removes the temp file unless it was renamed into place
+	renamed := false
+	defer func() {
+		if !renamed {
+			_ = os.Remove(tmpPath)
+		}
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("file write failed %s: %w", tmpPath, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("fsync failed %s: %w", tmpPath, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close failed %s: %w", tmpPath, err)
+	}
+	// CreateTemp makes the file 0600; the web server needs to read it
+	if err := os.Chmod(tmpPath, 0644); err != nil {
+		return fmt.Errorf("chmod failed %s: %w", tmpPath, err)
+	}
+
+	info, err := os.Stat(tmpPath)
+	if err != nil || info.Size() != int64(len(data)) {
+		return fmt.Errorf("file verification failed %s", tmpPath)
+	}
+
+	if err := os.Rename(tmpPath, fullPath); err != nil {
+		return fmt.Errorf("rename failed %s: %w", fullPath, err)
+	}
+	renamed = true
+
+	// Persist the rename itself
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		d.Close()
+	}
+
+	return nil
+}
+
+// SweepTempFiles removes temp files older than maxAge left under
+// property_images by downloads that were interrupted.
+// It returns how many files were removed. Only local storage leaves temp files.
+func SweepTempFiles(maxAge time.Duration) (int, error) {
+	local, ok := Store.(*LocalStorage)
+	if !ok {
+		return 0, nil
+	}
+
+	root := local.fullPath("property_images")
+	cutoff := time.Now().Add(-maxAge)
+	removed := 0
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || !strings.HasPrefix(d.Name(), tempFilePrefix) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			// Renamed or removed by its writer since the directory was read
+			return nil
+		}
+		if info.ModTime().After(cutoff) {
+			return nil
+		}
+
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("remove temp file %s: %w", path, err)
+		}
+		removed++
+		return nil
+	})
+
+	return removed, err
+}
@@ -0,0 +1,107 @@
+package media
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	tmpDir := t.TempDir()
+	fullPath := filepath.Join(tmpDir, "image.jpg")
+	data := testJPEG(t, 64, 48, 100)
+
+	if err := writeFileAtomic(fullPath, data); err != nil {
+		t.Fatalf("writeFileAtomic failed: %v", err)
+	}
+
+	got, err := os.ReadFile(fullPath)
+	if err != nil || len(got) != len(data) {
+		t.Fatalf("Expected %d bytes at %s, got %d (%v)", len(data), fullPath, len(got), err)
+	}
+
+	info, _ := os.Stat(fullPath)
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("Expected mode 0644, got %v", info.Mode().Perm())
+	}
+
+	// No temp file is left behind
+	entries, _ := os.ReadDir(tmpDir)
+	if len(entries) != 1 {
+		t.Errorf("Expected only the image in %s, got %d entries", tmpDir, len(entries))
+	}
+}
+
+func TestWriteFileAtomicFailureLeavesNothing(t *testing.T) {
+	tmpDir := t.TempDir()
+	// The final path is a directory, so the rename fails
+	fullPath := filepath.Join(tmpDir, "image.jpg")
+	if err := os.MkdirAll(filepath.Join(fullPath, "occupied"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	if err := writeFileAtomic(fullPath, testJPEG(t, 64, 48, 100)); err == nil {
+		t.Fatal("Expected rename onto a directory to fail")
+	}
+
+	entries, _ := os.ReadDir(tmpDir)
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), tempFilePrefix) {
+			t.Errorf("Temp file %s was left behind", e.Name())
+		}
+	}
+}
+
+func TestSweepTempFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	oldMediaRoot := MediaRoot
+	MediaRoot = tmpDir
+	defer func() {
+		MediaRoot = oldMediaRoot
+	}()
+
+	// Nothing to sweep before the first download
+	if n, err := SweepTempFiles(TempFileMaxAge); err != nil || n != 0 {
+		t.Fatalf("Expected no-op on a missing directory, got %d, %v", n, err)
+	}
+
+	dir := filepath.Join(tmpDir, "property_images")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	write := func(name string, age time.Duration) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte{0xFF, 0xD8}, 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		mtime := time.Now().Add(-age)
+		os.Chtimes(path, mtime, mtime)
+		return path
+	}
+
+	orphan := write(tempFilePrefix+"123", 2*time.Hour)
+	inFlight := write(tempFilePrefix+"456", time.Minute)
+	image := write("abc.jpg", 2*time.Hour)
+
+	n, err := SweepTempFiles(TempFileMaxAge)
+	if err != nil {
+		t.Fatalf("SweepTempFiles failed: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("Expected 1 file removed, got %d", n)
+	}
+
+	if _, err := os.Stat(orphan); !os.IsNotExist(err) {
+		t.Error("Orphaned temp file should be removed")
+	}
+	if _, err := os.Stat(inFlight); err != nil {
+		t.Error("Recent temp file should be kept")
+	}
+	if _, err := os.Stat(image); err != nil {
+		t.Error("Images must never be removed")
+	}
+}
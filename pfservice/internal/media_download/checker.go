@@ -1,23 +1,23 @@
 package media
 
 import (
-	"os"
+	"context"
 	"path/filepath"
 )
 
-// ImageExists checks if an image file exists on disk
-func ImageExists(imagePath string) bool {
+// ImageExists checks if an image file exists in Store.
+// Storage errors count as missing.
+func ImageExists(ctx context.Context, imagePath string) bool {
 	if imagePath == "" {
 		return false
 	}
 
-	fullPath := filepath.Join(MediaRoot, imagePath)
-	_, err := os.Stat(fullPath)
-	return err == nil
+	ok, err := Store.Exists(ctx, imagePath)
+	return err == nil && ok
 }
 
 // GetFullImagePath returns the full filesystem path for a relative image path
+// when media is stored on local disk under MediaRoot
 func GetFullImagePath(imagePath string) string {
 	return filepath.Join(MediaRoot, imagePath)
 }
-
@@ -1,24 +1,26 @@
 package media
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
-	"path/filepath"
 	"strconv"
-	"strings"
 	"time"
-
-	"github.com/google/uuid"
 )
 
 var MediaRoot = getMediaRoot()
 
 const (
-	defaultMaxRetries   = 3
-	defaultRetryDelay   = 2 * time.Second
+	defaultMaxRetries      = 3
+	defaultRetryDelay      = 2 * time.Second
 	defaultDownloadTimeout = 10 * time.Second
+
+	// maxImageBytes caps the size of one downloaded image held in memory
+	maxImageBytes = 50 << 20
 )
 
 func getMediaRoot() string {
@@ -56,109 +58,93 @@ func getDownloadTimeout() time.Duration {
 }
 
 // downloadImageAttempt performs a single download attempt
-// Uses configurable timeout to prevent long-running downloads from blocking
-// imageIndex is used to create unique filenames when UUID cannot be extracted
-func downloadImageAttempt(url string, propertyID uint, imageIndex int) (string, error) {
-	timeout := getDownloadTimeout()
-	client := &http.Client{
-		Timeout: timeout,
+// The client timeout prevents long-running downloads from blocking
+// The file is named by the SHA-256 of its content, so identical images are
+// stored once and downloading a file we already have writes nothing.
+// Only complete jpg, png and webp images are kept; the extension matches the format
+func downloadImageAttempt(ctx context.Context, client *http.Client, url string, propertyID uint, imageIndex int) (string, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", "", fmt.Errorf("bad request for url %s: %w", url, err)
 	}
 
-	resp, err := client.Get(url)
+	resp, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("http get failed: %w", err)
+		return "", "", fmt.Errorf("http get failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("bad status %d for url %s", resp.StatusCode, url)
-	}
-
-	saveDir := filepath.Join(MediaRoot, "property_images")
-	if err := os.MkdirAll(saveDir, 0755); err != nil {
-		return "", fmt.Errorf("mkdir failed %s: %w", saveDir, err)
-	}
-
-	// Extract unique filename from URL
-	// URLs like: /media/images/listing/ID/uuid/original.jpg or /media/tmp/uuid/filename_original.jpg
-	// We need to extract the UUID part, not just "original.jpg"
-	urlPath := resp.Request.URL.Path
-	pathParts := strings.Split(strings.Trim(urlPath, "/"), "/")
-	
-	var filename string
-	// Look for UUID-like strings in the path (contains dashes, 30+ chars)
-	// Example: ce5950dd-d4b0-478e-ad32-176b8900bef1
-	// Also check filename itself for UUID (e.g., f4440543-f51c-4227-bb92-6b24bbf466a3_original.jpg)
-	for i := len(pathParts) - 1; i >= 0; i-- {
-		part := pathParts[i]
-		// Check if this part looks like a UUID (contains dashes and is long enough)
-		if strings.Contains(part, "-") && len(part) >= 30 {
-			// If part contains _original.jpg or similar, extract just the UUID part
-			if strings.Contains(part, "_original") {
-				uuidPart := strings.Split(part, "_")[0]
-				if len(uuidPart) >= 30 && strings.Contains(uuidPart, "-") {
-					filename = uuidPart + ".jpg"
-					break
-				}
-			} else {
-				filename = part + ".jpg"
-				break
-			}
-		}
-	}
-	
-	// If no UUID found, use property ID + image index + URL hash for uniqueness
-	if filename == "" {
-		// Use property ID + image index + hash from URL path for unique filename
-		urlHash := fmt.Sprintf("%x", urlPath)
-		if len(urlHash) > 8 {
-			filename = fmt.Sprintf("pf_%d_%d_%s.jpg", propertyID, imageIndex, urlHash[:8])
-		} else {
-			filename = fmt.Sprintf("pf_%d_%d_%s.jpg", propertyID, imageIndex, uuid.New().String()[:8])
-		}
-	}
-	
-	// Fallback if still empty
-	if filename == "" {
-		filename = fmt.Sprintf("pf_%d_%d_%s.jpg", propertyID, imageIndex, uuid.New().String()[:8])
+		return "", "", fmt.Errorf("bad status %d for url %s", resp.StatusCode, url)
 	}
 
-	fullPath := filepath.Join(saveDir, filename)
-
-	out, err := os.Create(fullPath)
+	// The content is hashed before anything is written
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxImageBytes+1))
 	if err != nil {
-		return "", fmt.Errorf("file create failed %s: %w", fullPath, err)
+		return "", "", fmt.Errorf("read failed for property %d image %d: %w", propertyID, imageIndex, err)
+	}
+	if len(data) == 0 {
+		return "", "", fmt.Errorf("empty file downloaded from %s", url)
+	}
+	if len(data) > maxImageBytes {
+		return "", "", fmt.Errorf("image larger than %d bytes at %s", maxImageBytes, url)
 	}
-	defer out.Close()
 
-	written, err := io.Copy(out, resp.Body)
+	// HTML error pages and truncated files are rejected and retried
+	ext, err := validateImage(data)
 	if err != nil {
-		_ = os.Remove(fullPath)
-		return "", fmt.Errorf("file write failed %s: %w", fullPath, err)
+		return "", "", fmt.Errorf("bad image from %s: %w", url, err)
 	}
 
-	if written == 0 {
-		_ = os.Remove(fullPath)
-		return "", fmt.Errorf("empty file downloaded from %s", url)
+	hash := ContentHash(data)
+	imagePath := "property_images/" + hash + ext
+
+	// Same content already stored
+	if info, err := Store.Stat(ctx, imagePath); err == nil && info.Size == int64(len(data)) {
+		return imagePath, hash, nil
 	}
 
-	info, err := os.Stat(fullPath)
-	if err != nil || info.Size() == 0 {
-		_ = os.Remove(fullPath)
-		return "", fmt.Errorf("file verification failed %s", fullPath)
+	// A crash mid-write never leaves a partial image at imagePath
+	if err := Store.Put(ctx, imagePath, data); err != nil {
+		return "", "", fmt.Errorf("store failed %s: %w", imagePath, err)
 	}
 
-	return filepath.Join("property_images", filename), nil
+	return imagePath, hash, nil
+}
+
+// ContentHash returns the hex SHA-256 of data, used as the stored filename
+func ContentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// HashImageFile returns the ContentHash of a stored image file
+func HashImageFile(ctx context.Context, imagePath string) (string, error) {
+	data, err := Store.Get(ctx, imagePath)
+	if err != nil {
+		return "", err
+	}
+	return ContentHash(data), nil
 }
 
 // DownloadImage downloads an image with retry logic
 // It will retry up to maxRetries times if the download fails
 // Returns the relative path to the downloaded image or an error
-// imageIndex is used to create unique filenames (0-based index)
-func DownloadImage(url string, propertyID uint, imageIndex int) (string, error) {
+// The path is property_images/<sha256 of content> with a .jpg, .png or .webp extension
+// Cancelling ctx aborts the current attempt and skips the remaining retries
+func DownloadImage(ctx context.Context, url string, propertyID uint, imageIndex int) (string, error) {
+	client := &http.Client{
+		Timeout: getDownloadTimeout(),
+	}
+	path, _, err := downloadImage(ctx, client, url, propertyID, imageIndex)
+	return path, err
+}
+
+// downloadImage runs the download attempts for one image using client
+func downloadImage(ctx context.Context, client *http.Client, url string, propertyID uint, imageIndex int) (string, string, error) {
 	// Skip if URL is empty
 	if url == "" {
-		return "", fmt.Errorf("empty URL provided")
+		return "", "", fmt.Errorf("empty URL provided")
 	}
 
 	maxRetries := getMaxRetries()
@@ -166,26 +152,38 @@ func DownloadImage(url string, propertyID uint, imageIndex int) (string, error)
 	var lastErr error
 
 	for attempt := 1; attempt <= maxRetries; attempt++ {
-		path, err := downloadImageAttempt(url, propertyID, imageIndex)
+		path, hash, err := downloadImageAttempt(ctx, client, url, propertyID, imageIndex)
 		if err == nil {
 			// Success on first attempt, no need to log
 			if attempt > 1 {
 				// Log successful retry
 				fmt.Printf("Image download succeeded on attempt %d for URL: %s\n", attempt, url)
 			}
-			return path, nil
+			// Variants are best effort; pf_check reports missing ones and pf_repair regenerates them
+			if _, err := GenerateVariants(ctx, path); err != nil {
+				fmt.Printf("Warning: failed to generate variants for %s: %v\n", path, err)
+			}
+			return path, hash, nil
 		}
 
 		lastErr = err
 
+		if ctx.Err() != nil {
+			return "", "", fmt.Errorf("image download cancelled: %w", ctx.Err())
+		}
+
 		// Don't retry on last attempt
 		if attempt < maxRetries {
 			fmt.Printf("Image download attempt %d/%d failed for URL %s: %v. Retrying in %v...\n",
 				attempt, maxRetries, url, err, retryDelay)
-			time.Sleep(retryDelay)
+			select {
+			case <-ctx.Done():
+				return "", "", fmt.Errorf("image download cancelled: %w", ctx.Err())
+			case <-time.After(retryDelay):
+			}
 		}
 	}
 
 	// All retries failed
-	return "", fmt.Errorf("image download failed after %d attempts: %w", maxRetries, lastErr)
+	return "", "", fmt.Errorf("image download failed after %d attempts: %w", maxRetries, lastErr)
 }
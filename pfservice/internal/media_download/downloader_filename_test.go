@@ -1,12 +1,13 @@
 package media
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
-	"strings"
 	"testing"
+	"time"
 )
 
 func TestDownloadImageUniqueFilenames(t *testing.T) {
@@ -22,17 +23,21 @@ func TestDownloadImageUniqueFilenames(t *testing.T) {
 		MediaRoot = oldMediaRoot
 	}()
 
-	// Create test server with UUID in URL path
-	testImageData := []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x10, 0x4A, 0x46, 0x49, 0x46}
+	// Each URL serves different content
+	images := map[string][]byte{
+		"/media/images/listing/ID1/ce5950dd-d4b0-478e-ad32-176b8900bef1/original.jpg": testJPEG(t, 64, 48, 50),
+		"/media/images/listing/ID2/991f8733-ac63-4b7b-8a44-d8586cae82a0/original.jpg": testJPEG(t, 64, 48, 150),
+		"/media/images/listing/ID3/741275b0-4d08-4129-a86c-7a69537e7aba/original.jpg": testJPEG(t, 64, 48, 250),
+	}
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "image/jpeg")
 		w.WriteHeader(http.StatusOK)
-		w.Write(testImageData)
+		w.Write(images[r.URL.Path])
 	}))
 	defer server.Close()
 
 	propertyID := uint(123)
-	
+
 	// Test multiple images with same "original.jpg" ending - should get unique names
 	urls := []string{
 		server.URL + "/media/images/listing/ID1/ce5950dd-d4b0-478e-ad32-176b8900bef1/original.jpg",
@@ -41,9 +46,9 @@ func TestDownloadImageUniqueFilenames(t *testing.T) {
 	}
 
 	downloadedFiles := make(map[string]bool)
-	
+
 	for idx, url := range urls {
-		localPath, err := DownloadImage(url, propertyID, idx)
+		localPath, err := DownloadImage(context.Background(), url, propertyID, idx)
 		if err != nil {
 			t.Fatalf("Failed to download image %d: %v", idx, err)
 		}
@@ -57,18 +62,14 @@ func TestDownloadImageUniqueFilenames(t *testing.T) {
 
 		// Verify file exists
 		fullPath := filepath.Join(MediaRoot, localPath)
-		if _, err := os.Stat(fullPath); os.IsNotExist(err) {
-			t.Errorf("Downloaded file does not exist at %s", fullPath)
+		data, err := os.ReadFile(fullPath)
+		if err != nil {
+			t.Fatalf("Downloaded file does not exist at %s", fullPath)
 		}
 
-		// Verify filename contains UUID or property ID
-		if !strings.Contains(filename, "ce5950dd-d4b0-478e-ad32-176b8900bef1") && 
-		   !strings.Contains(filename, "991f8733-ac63-4b7b-8a44-d8586cae82a0") &&
-		   !strings.Contains(filename, "741275b0-4d08-4129-a86c-7a69537e7aba") {
-			// If UUID not in filename, should have property ID
-			if !strings.Contains(filename, "pf_123") {
-				t.Errorf("Filename should contain UUID or property ID, got: %s", filename)
-			}
+		// Filename is the SHA-256 of the content
+		if filename != ContentHash(data)+".jpg" {
+			t.Errorf("Expected filename %s.jpg, got %s", ContentHash(data), filename)
 		}
 	}
 
@@ -78,7 +79,7 @@ func TestDownloadImageUniqueFilenames(t *testing.T) {
 	}
 }
 
-func TestDownloadImageFilenameWithUUID(t *testing.T) {
+func TestDownloadImageDeduplicatesContent(t *testing.T) {
 	tmpDir, err := os.MkdirTemp("", "pf-service-test-media-*")
 	if err != nil {
 		t.Fatalf("Failed to create temp directory: %v", err)
@@ -91,7 +92,15 @@ func TestDownloadImageFilenameWithUUID(t *testing.T) {
 		MediaRoot = oldMediaRoot
 	}()
 
-	testImageData := []byte{0xFF, 0xD8, 0xFF, 0xE0}
+	// Only originals are counted below
+	oldVariants := Variants
+	Variants = nil
+	defer func() {
+		Variants = oldVariants
+	}()
+
+	// The same photo reused by two listings
+	testImageData := testJPEG(t, 64, 48, 100)
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "image/jpeg")
 		w.WriteHeader(http.StatusOK)
@@ -99,56 +108,40 @@ func TestDownloadImageFilenameWithUUID(t *testing.T) {
 	}))
 	defer server.Close()
 
-	// Test URL with UUID
-	url := server.URL + "/media/images/listing/Z1XHGC2QB0ARA317TMC2F5K2ZW/ce5950dd-d4b0-478e-ad32-176b8900bef1/original.jpg"
-	localPath, err := DownloadImage(url, 1061, 0)
+	first, err := DownloadImage(context.Background(), server.URL+"/media/images/listing/A/ce5950dd-d4b0-478e-ad32-176b8900bef1/original.jpg", 1061, 0)
 	if err != nil {
 		t.Fatalf("Failed to download image: %v", err)
 	}
 
-	filename := filepath.Base(localPath)
-	// Should extract UUID from URL
-	if !strings.Contains(filename, "ce5950dd-d4b0-478e-ad32-176b8900bef1") {
-		t.Errorf("Expected filename to contain UUID, got: %s", filename)
+	info, err := os.Stat(filepath.Join(MediaRoot, first))
+	if err != nil {
+		t.Fatalf("Downloaded file missing: %v", err)
 	}
-}
+	// Backdate the file so a rewrite would be visible
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(filepath.Join(MediaRoot, first), old, old)
 
-func TestDownloadImageFilenameWithoutUUID(t *testing.T) {
-	tmpDir, err := os.MkdirTemp("", "pf-service-test-media-*")
+	second, err := DownloadImage(context.Background(), server.URL+"/media/images/listing/B/991f8733-ac63-4b7b-8a44-d8586cae82a0/original.jpg", 1052, 5)
 	if err != nil {
-		t.Fatalf("Failed to create temp directory: %v", err)
+		t.Fatalf("Failed to download image: %v", err)
 	}
-	defer os.RemoveAll(tmpDir)
 
-	oldMediaRoot := MediaRoot
-	MediaRoot = tmpDir
-	defer func() {
-		MediaRoot = oldMediaRoot
-	}()
+	if first != second {
+		t.Errorf("Expected identical content to share a path, got %s and %s", first, second)
+	}
 
-	testImageData := []byte{0xFF, 0xD8, 0xFF, 0xE0}
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "image/jpeg")
-		w.WriteHeader(http.StatusOK)
-		w.Write(testImageData)
-	}))
-	defer server.Close()
+	entries, _ := os.ReadDir(filepath.Join(MediaRoot, "property_images"))
+	if len(entries) != 1 {
+		t.Errorf("Expected 1 stored file, got %d", len(entries))
+	}
 
-	// Test URL with UUID in filename but not in path (tmp path)
-	// URL: /media/tmp/979aa4e2-0ce0-4717-b230-81a2babeeac6/f4440543-f51c-4227-bb92-6b24bbf466a3_original.jpg
-	// The UUID f4440543-f51c-4227-bb92-6b24bbf466a3 should be extracted
-	url := server.URL + "/media/tmp/979aa4e2-0ce0-4717-b230-81a2babeeac6/f4440543-f51c-4227-bb92-6b24bbf466a3_original.jpg"
-	localPath, err := DownloadImage(url, 1052, 5)
-	if err != nil {
-		t.Fatalf("Failed to download image: %v", err)
+	info, _ = os.Stat(filepath.Join(MediaRoot, second))
+	if !info.ModTime().Equal(old) {
+		t.Error("Existing file should not be rewritten")
 	}
 
-	filename := filepath.Base(localPath)
-	// Should extract UUID from filename or use property ID + index + hash
-	// The UUID f4440543-f51c-4227-bb92-6b24bbf466a3 might be extracted, or property ID format used
-	hasUUID := strings.Contains(filename, "f4440543-f51c-4227-bb92-6b24bbf466a3")
-	hasPropertyID := strings.Contains(filename, "pf_1052")
-	if !hasUUID && !hasPropertyID {
-		t.Errorf("Expected filename to contain UUID or property ID, got: %s", filename)
+	hash, err := HashImageFile(context.Background(), second)
+	if err != nil || hash != ContentHash(testImageData) {
+		t.Errorf("HashImageFile = %q, %v; want %q", hash, err, ContentHash(testImageData))
 	}
 }
@@ -1,6 +1,8 @@
 package media
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -26,7 +28,7 @@ func TestDownloadImage(t *testing.T) {
 	}()
 
 	// Create a test HTTP server that serves an image
-	testImageData := []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x10, 0x4A, 0x46, 0x49, 0x46} // JPEG header
+	testImageData := testJPEG(t, 64, 48, 100)
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "image/jpeg")
 		w.WriteHeader(http.StatusOK)
@@ -36,7 +38,7 @@ func TestDownloadImage(t *testing.T) {
 
 	// Test downloading image
 	propertyID := uint(123)
-	localPath, err := DownloadImage(server.URL+"/test-image.jpg", propertyID, 0)
+	localPath, err := DownloadImage(context.Background(), server.URL+"/test-image.jpg", propertyID, 0)
 	if err != nil {
 		t.Fatalf("Failed to download image: %v", err)
 	}
@@ -86,7 +88,7 @@ func TestDownloadImageWithInvalidURL(t *testing.T) {
 	}()
 
 	// Test with invalid URL
-	_, err = DownloadImage("http://invalid-url-that-does-not-exist-12345.com/image.jpg", 123, 0)
+	_, err = DownloadImage(context.Background(), "http://invalid-url-that-does-not-exist-12345.com/image.jpg", 123, 0)
 	if err == nil {
 		t.Error("Expected error for invalid URL")
 	}
@@ -111,7 +113,7 @@ func TestDownloadImageWithErrorResponse(t *testing.T) {
 	}))
 	defer server.Close()
 
-	_, err = DownloadImage(server.URL+"/not-found.jpg", 123, 0)
+	_, err = DownloadImage(context.Background(), server.URL+"/not-found.jpg", 123, 0)
 	if err == nil {
 		t.Error("Expected error for 404 response")
 	}
@@ -137,7 +139,7 @@ func TestDownloadImageWithEmptyResponse(t *testing.T) {
 	}))
 	defer server.Close()
 
-	_, err = DownloadImage(server.URL+"/empty.jpg", 123, 0)
+	_, err = DownloadImage(context.Background(), server.URL+"/empty.jpg", 123, 0)
 	if err == nil {
 		t.Error("Expected error for empty response")
 	}
@@ -157,7 +159,7 @@ func TestDownloadImageWithUUIDFallback(t *testing.T) {
 	}()
 
 	// Create a test server with URL that has no filename
-	testImageData := []byte{0xFF, 0xD8, 0xFF, 0xE0}
+	testImageData := testJPEG(t, 64, 48, 100)
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "image/jpeg")
 		w.WriteHeader(http.StatusOK)
@@ -166,12 +168,12 @@ func TestDownloadImageWithUUIDFallback(t *testing.T) {
 	defer server.Close()
 
 	// Test with URL that has no filename
-	localPath, err := DownloadImage(server.URL, 123, 0)
+	localPath, err := DownloadImage(context.Background(), server.URL, 123, 0)
 	if err != nil {
 		t.Fatalf("Failed to download image: %v", err)
 	}
 
-	// Should generate UUID filename
+	// Should be named by content hash
 	if !filepath.HasPrefix(localPath, "property_images/") {
 		t.Errorf("Expected path to start with property_images/, got %s", localPath)
 	}
@@ -180,6 +182,107 @@ func TestDownloadImageWithUUIDFallback(t *testing.T) {
 	}
 }
 
+func TestDownloadImageKeepsRealFormat(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "pf-service-test-media-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	oldMediaRoot := MediaRoot
+	MediaRoot = tmpDir
+	defer func() {
+		MediaRoot = oldMediaRoot
+	}()
+
+	// A PNG behind a .jpg URL and a wrong Content-Type
+	testImageData := testPNG(t, 64, 48, 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.WriteHeader(http.StatusOK)
+		w.Write(testImageData)
+	}))
+	defer server.Close()
+
+	localPath, err := DownloadImage(context.Background(), server.URL+"/photo.jpg", 123, 0)
+	if err != nil {
+		t.Fatalf("Failed to download image: %v", err)
+	}
+
+	if localPath != "property_images/"+ContentHash(testImageData)+".png" {
+		t.Errorf("Expected a .png named by content hash, got %s", localPath)
+	}
+}
+
+func TestDownloadImageRejectsInvalidContent(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "pf-service-test-media-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	oldMediaRoot := MediaRoot
+	MediaRoot = tmpDir
+	defer func() {
+		MediaRoot = oldMediaRoot
+	}()
+
+	// Only originals are counted below
+	oldVariants := Variants
+	Variants = nil
+	defer func() {
+		Variants = oldVariants
+	}()
+
+	t.Setenv("IMAGE_DOWNLOAD_MAX_RETRIES", "3")
+	t.Setenv("IMAGE_DOWNLOAD_RETRY_DELAY", "0")
+
+	// An HTML error page, then a truncated JPEG, both with 200, then the real image
+	testImageData := testJPEG(t, 64, 48, 100)
+	attemptCount := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attemptCount++
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.WriteHeader(http.StatusOK)
+		switch attemptCount {
+		case 1:
+			w.Write([]byte("<html><body>Service Unavailable</body></html>"))
+		case 2:
+			w.Write(testImageData[:len(testImageData)/2])
+		default:
+			w.Write(testImageData)
+		}
+	}))
+	defer server.Close()
+
+	localPath, err := DownloadImage(context.Background(), server.URL+"/flaky.jpg", 123, 0)
+	if err != nil {
+		t.Fatalf("Failed to download image after retries: %v", err)
+	}
+	if attemptCount != 3 {
+		t.Errorf("Expected invalid content to be retried, got %d attempts", attemptCount)
+	}
+
+	// Only the valid image was stored
+	entries, _ := os.ReadDir(filepath.Join(MediaRoot, "property_images"))
+	if len(entries) != 1 || "property_images/"+entries[0].Name() != localPath {
+		t.Errorf("Expected only %s to be stored, got %v", localPath, entries)
+	}
+
+	// A server that never returns an image fails after all attempts
+	htmlServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("<!DOCTYPE html><html><body>Not here</body></html>"))
+	}))
+	defer htmlServer.Close()
+
+	_, err = DownloadImage(context.Background(), htmlServer.URL+"/page.jpg", 123, 0)
+	if !errors.Is(err, ErrInvalidImage) {
+		t.Errorf("Expected ErrInvalidImage, got %v", err)
+	}
+}
+
 func TestGetMediaRoot(t *testing.T) {
 	// Test default value
 	oldEnv := os.Getenv("MEDIA_ROOT")
@@ -222,7 +325,7 @@ func TestDownloadImageWithRetry(t *testing.T) {
 
 	// Create a test server that fails first 2 times, then succeeds
 	attemptCount := 0
-	testImageData := []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x10, 0x4A, 0x46, 0x49, 0x46}
+	testImageData := testJPEG(t, 64, 48, 100)
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		attemptCount++
 		if attemptCount < 3 {
@@ -257,7 +360,7 @@ func TestDownloadImageWithRetry(t *testing.T) {
 
 	// Test downloading image with retry
 	propertyID := uint(123)
-	localPath, err := DownloadImage(server.URL+"/test-retry.jpg", propertyID, 0)
+	localPath, err := DownloadImage(context.Background(), server.URL+"/test-retry.jpg", propertyID, 0)
 	if err != nil {
 		t.Fatalf("Failed to download image after retries: %v", err)
 	}
@@ -318,7 +421,7 @@ func TestDownloadImageWithRetryFailure(t *testing.T) {
 
 	// Test downloading image - should fail after all retries
 	propertyID := uint(123)
-	_, err = DownloadImage(server.URL+"/test-fail.jpg", propertyID, 0)
+	_, err = DownloadImage(context.Background(), server.URL+"/test-fail.jpg", propertyID, 0)
 	if err == nil {
 		t.Error("Expected error after all retries failed")
 	}
@@ -343,7 +446,7 @@ func TestDownloadImageWithEmptyURL(t *testing.T) {
 	}()
 
 	// Test with empty URL - should not retry
-	_, err = DownloadImage("", 123, 0)
+	_, err = DownloadImage(context.Background(), "", 123, 0)
 	if err == nil {
 		t.Error("Expected error for empty URL")
 	}
@@ -366,12 +469,13 @@ func TestDownloadImageWithTimeout(t *testing.T) {
 	}()
 
 	// Create a test server that delays response longer than timeout
+	testImageData := testJPEG(t, 64, 48, 100)
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Delay for 15 seconds (longer than default 10s timeout)
 		time.Sleep(15 * time.Second)
 		w.Header().Set("Content-Type", "image/jpeg")
 		w.WriteHeader(http.StatusOK)
-		w.Write([]byte{0xFF, 0xD8, 0xFF, 0xE0})
+		w.Write(testImageData)
 	}))
 	defer server.Close()
 
@@ -406,7 +510,7 @@ func TestDownloadImageWithTimeout(t *testing.T) {
 
 	// Test downloading image - should timeout
 	start := time.Now()
-	_, err = DownloadImage(server.URL+"/timeout-test.jpg", 123, 0)
+	_, err = DownloadImage(context.Background(), server.URL+"/timeout-test.jpg", 123, 0)
 	duration := time.Since(start)
 
 	if err == nil {
@@ -423,3 +527,41 @@ func TestDownloadImageWithTimeout(t *testing.T) {
 		t.Logf("Timeout error (may vary by Go version): %v", err)
 	}
 }
+
+func TestDownloadImageCancelledDuringRetry(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "pf-service-test-media-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	oldMediaRoot := MediaRoot
+	MediaRoot = tmpDir
+	defer func() {
+		MediaRoot = oldMediaRoot
+	}()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	// Long retry delay: cancellation must cut it short
+	t.Setenv("IMAGE_DOWNLOAD_MAX_RETRIES", "3")
+	t.Setenv("IMAGE_DOWNLOAD_RETRY_DELAY", "30")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = DownloadImage(ctx, server.URL+"/cancelled.jpg", 123, 0)
+	if err == nil {
+		t.Error("Expected error when context is cancelled")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("Cancelled download should return promptly, took %v", time.Since(start))
+	}
+	if err != nil && !strings.Contains(err.Error(), "cancelled") {
+		t.Errorf("Expected cancellation error, got: %v", err)
+	}
+}
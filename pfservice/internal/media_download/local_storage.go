@@ -0,0 +1,102 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalStorage keeps media files on local disk under Root.
+// An empty Root means MediaRoot, read on every call.
+type LocalStorage struct {
+	Root string
+}
+
+func (s *LocalStorage) root() string {
+	if s.Root != "" {
+		return s.Root
+	}
+	return MediaRoot
+}
+
+func (s *LocalStorage) fullPath(path string) string {
+	return filepath.Join(s.root(), filepath.FromSlash(path))
+}
+
+// Put writes through a synced temp file renamed into place
+func (s *LocalStorage) Put(ctx context.Context, path string, data []byte) error {
+	fullPath := s.fullPath(path)
+	saveDir := filepath.Dir(fullPath)
+	if err := os.MkdirAll(saveDir, 0755); err != nil {
+		return fmt.Errorf("mkdir failed %s: %w", saveDir, err)
+	}
+	return writeFileAtomic(fullPath, data)
+}
+
+func (s *LocalStorage) Get(ctx context.Context, path string) ([]byte, error) {
+	return os.ReadFile(s.fullPath(path))
+}
+
+func (s *LocalStorage) Exists(ctx context.Context, path string) (bool, error) {
+	_, err := os.Stat(s.fullPath(path))
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return false, err
+}
+
+func (s *LocalStorage) Stat(ctx context.Context, path string) (FileInfo, error) {
+	info, err := os.Stat(s.fullPath(path))
+	if err != nil {
+		return FileInfo{}, err
+	}
+	return FileInfo{Path: path, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, path string) error {
+	err := os.Remove(s.fullPath(path))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// List walks the directory at prefix. Temp files of writes in progress are skipped.
+func (s *LocalStorage) List(ctx context.Context, prefix string, fn func(FileInfo) error) error {
+	root := s.root()
+	start := s.fullPath(prefix)
+	if _, err := os.Stat(start); errors.Is(err, fs.ErrNotExist) {
+		// Nothing stored under prefix yet
+		return nil
+	}
+
+	return filepath.WalkDir(start, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), tempFilePrefix) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			// Removed since the directory was read
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		return fn(FileInfo{Path: filepath.ToSlash(rel), Size: info.Size(), ModTime: info.ModTime()})
+	})
+}
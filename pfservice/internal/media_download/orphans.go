@@ -0,0 +1,52 @@
+package media
+
+import (
+	"context"
+	"time"
+)
+
+// OrphanScan is the result of FindOrphans
+type OrphanScan struct {
+	// Orphans are unreferenced files older than the grace period
+	Orphans []FileInfo
+	// OrphanBytes is the total size of Orphans
+	OrphanBytes int64
+	// Recent are unreferenced files still inside the grace period; a download
+	// may be waiting for its database commit
+	Recent []FileInfo
+	// Scanned is the number of files seen
+	Scanned int
+}
+
+// FindOrphans lists the files under prefix in Store that are not in referenced.
+// Variants of referenced images count as referenced. Files modified after
+// now-grace are reported as Recent, not as orphans.
+func FindOrphans(ctx context.Context, prefix string, referenced map[string]bool, grace time.Duration, now time.Time) (OrphanScan, error) {
+	// Variants are not in the database; they belong to their original
+	keep := make(map[string]bool, len(referenced)*(len(Variants)+1))
+	for path := range referenced {
+		keep[path] = true
+		for _, v := range Variants {
+			keep[VariantPath(path, v.Name)] = true
+		}
+	}
+
+	cutoff := now.Add(-grace)
+	var scan OrphanScan
+
+	err := Store.List(ctx, prefix, func(info FileInfo) error {
+		scan.Scanned++
+		if keep[info.Path] {
+			return nil
+		}
+		if info.ModTime.After(cutoff) {
+			scan.Recent = append(scan.Recent, info)
+			return nil
+		}
+		scan.Orphans = append(scan.Orphans, info)
+		scan.OrphanBytes += info.Size
+		return nil
+	})
+
+	return scan, err
+}
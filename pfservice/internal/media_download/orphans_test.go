@@ -0,0 +1,71 @@
+package media
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestFindOrphans(t *testing.T) {
+	oldStore := Store
+	Store = &LocalStorage{Root: t.TempDir()}
+	oldVariants := Variants
+	Variants = []Variant{{"thumb", 320}}
+	defer func() {
+		Store = oldStore
+		Variants = oldVariants
+	}()
+
+	ctx := context.Background()
+	now := time.Now()
+
+	files := map[string]string{
+		"property_images/kept.jpg":         "kept",
+		"property_images/kept_thumb.jpg":   "k",
+		"property_images/orphan.jpg":       "orphan",
+		"property_images/orphan_thumb.jpg": "o",
+		"property_images/fresh.jpg":        "fresh",
+	}
+	for path, data := range files {
+		if err := Store.Put(ctx, path, []byte(data)); err != nil {
+			t.Fatalf("Put %s failed: %v", path, err)
+		}
+	}
+
+	// Everything but fresh.jpg is older than the grace period
+	local := Store.(*LocalStorage)
+	old := now.Add(-48 * time.Hour)
+	for path := range files {
+		if path != "property_images/fresh.jpg" {
+			if err := os.Chtimes(local.fullPath(path), old, old); err != nil {
+				t.Fatalf("Chtimes %s failed: %v", path, err)
+			}
+		}
+	}
+
+	referenced := map[string]bool{"property_images/kept.jpg": true}
+	scan, err := FindOrphans(ctx, "property_images", referenced, 24*time.Hour, now)
+	if err != nil {
+		t.Fatalf("FindOrphans failed: %v", err)
+	}
+
+	if scan.Scanned != len(files) {
+		t.Errorf("Expected %d files scanned, got %d", len(files), scan.Scanned)
+	}
+
+	orphans := map[string]bool{}
+	for _, f := range scan.Orphans {
+		orphans[f.Path] = true
+	}
+	if len(orphans) != 2 || !orphans["property_images/orphan.jpg"] || !orphans["property_images/orphan_thumb.jpg"] {
+		t.Errorf("Unexpected orphans %v", orphans)
+	}
+	if scan.OrphanBytes != int64(len("orphan")+len("o")) {
+		t.Errorf("Expected %d orphan bytes, got %d", len("orphan")+len("o"), scan.OrphanBytes)
+	}
+
+	if len(scan.Recent) != 1 || scan.Recent[0].Path != "property_images/fresh.jpg" {
+		t.Errorf("Expected fresh.jpg inside the grace period, got %v", scan.Recent)
+	}
+}
@@ -0,0 +1,153 @@
+package media
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+)
+
+const (
+	defaultConcurrency = 4
+	defaultPerHost     = 4
+)
+
+func getConcurrency() int {
+	if v := os.Getenv("IMAGE_DOWNLOAD_CONCURRENCY"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+	}
+	return defaultConcurrency
+}
+
+func getPerHostLimit() int {
+	if v := os.Getenv("IMAGE_DOWNLOAD_PER_HOST"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+	}
+	return defaultPerHost
+}
+
+// ImageJob is one image to download through a Pool
+type ImageJob struct {
+	URL        string
+	PropertyID uint
+	Index      int
+
+	// Key groups jobs for the caller, e.g. the listing pf_id
+	Key string
+	// ImageID is set when the job re-downloads the file of an existing image record
+	ImageID uint
+}
+
+// ImageResult is the outcome of an ImageJob.
+// Path is the relative path of the downloaded file and Hash the SHA-256 of
+// its content when Err is nil.
+type ImageResult struct {
+	Job  ImageJob
+	Path string
+	Hash string
+	Err  error
+}
+
+// PoolOptions configures a download Pool.
+// Zero values fall back to IMAGE_DOWNLOAD_CONCURRENCY / IMAGE_DOWNLOAD_PER_HOST.
+type PoolOptions struct {
+	Concurrency int
+	PerHost     int
+	QueueSize   int
+}
+
+// Pool downloads images with a bounded number of workers.
+// Jobs are queued with Submit and their outcomes delivered on Results.
+// Close must be called once all jobs are submitted; Results is closed
+// after the last job finishes.
+type Pool struct {
+	ctx     context.Context
+	client  *http.Client
+	jobs    chan ImageJob
+	results chan ImageResult
+	wg      sync.WaitGroup
+	once    sync.Once
+}
+
+// NewPool starts the pool workers. Cancelling ctx aborts downloads in flight;
+// jobs still queued then fail immediately with the context error.
+func NewPool(ctx context.Context, opts PoolOptions) *Pool {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = getConcurrency()
+	}
+	if opts.PerHost <= 0 {
+		opts.PerHost = getPerHostLimit()
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = opts.Concurrency * 4
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxConnsPerHost = opts.PerHost
+	transport.MaxIdleConnsPerHost = opts.PerHost
+
+	p := &Pool{
+		ctx: ctx,
+		client: &http.Client{
+			Timeout:   getDownloadTimeout(),
+			Transport: transport,
+		},
+		jobs:    make(chan ImageJob, opts.QueueSize),
+		results: make(chan ImageResult, opts.QueueSize),
+	}
+
+	for i := 0; i < opts.Concurrency; i++ {
+		p.wg.Add(1)
+		go p.worker()
+	}
+
+	go func() {
+		p.wg.Wait()
+		close(p.results)
+	}()
+
+	return p
+}
+
+func (p *Pool) worker() {
+	defer p.wg.Done()
+
+	for job := range p.jobs {
+		path, hash, err := downloadImage(p.ctx, p.client, job.URL, job.PropertyID, job.Index)
+		p.results <- ImageResult{Job: job, Path: path, Hash: hash, Err: err}
+	}
+}
+
+// Submit queues a job, blocking while the queue is full.
+// It returns false if the pool context is cancelled before the job is queued.
+// Submit must not be called after Close.
+func (p *Pool) Submit(job ImageJob) bool {
+	if p.ctx.Err() != nil {
+		return false
+	}
+
+	select {
+	case <-p.ctx.Done():
+		return false
+	case p.jobs <- job:
+		return true
+	}
+}
+
+// Results returns the channel of finished jobs.
+// It must be drained, otherwise workers block once the buffer is full.
+func (p *Pool) Results() <-chan ImageResult {
+	return p.results
+}
+
+// Close stops accepting jobs. Results is closed after queued jobs finish.
+func (p *Pool) Close() {
+	p.once.Do(func() {
+		close(p.jobs)
+	})
+}
@@ -0,0 +1,133 @@
+package media
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPoolDownloadsAllJobs(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "pf-service-test-media-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	oldMediaRoot := MediaRoot
+	MediaRoot = tmpDir
+	defer func() {
+		MediaRoot = oldMediaRoot
+	}()
+
+	// Track how many requests are served at the same time
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	testImageData := testJPEG(t, 64, 48, 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write(testImageData)
+	}))
+	defer server.Close()
+
+	pool := NewPool(context.Background(), PoolOptions{Concurrency: 3, PerHost: 3})
+
+	const jobs = 12
+	go func() {
+		for i := 0; i < jobs; i++ {
+			pool.Submit(ImageJob{
+				URL:        fmt.Sprintf("%s/image-%d.jpg", server.URL, i),
+				PropertyID: 42,
+				Index:      i,
+				Key:        "listing-1",
+			})
+		}
+		pool.Close()
+	}()
+
+	seen := make(map[int]bool)
+	for res := range pool.Results() {
+		if res.Err != nil {
+			t.Errorf("Job %d failed: %v", res.Job.Index, res.Err)
+			continue
+		}
+		if !ImageExists(context.Background(), res.Path) {
+			t.Errorf("Job %d reported %s but file does not exist", res.Job.Index, res.Path)
+		}
+		if res.Job.Key != "listing-1" {
+			t.Errorf("Result lost its job key: %+v", res.Job)
+		}
+		seen[res.Job.Index] = true
+	}
+
+	if len(seen) != jobs {
+		t.Errorf("Expected %d results, got %d", jobs, len(seen))
+	}
+	if maxInFlight > 3 {
+		t.Errorf("Expected at most 3 concurrent downloads, got %d", maxInFlight)
+	}
+}
+
+func TestPoolCancellation(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "pf-service-test-media-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	oldMediaRoot := MediaRoot
+	MediaRoot = tmpDir
+	defer func() {
+		MediaRoot = oldMediaRoot
+	}()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pool := NewPool(ctx, PoolOptions{Concurrency: 2})
+
+	for i := 0; i < 4; i++ {
+		pool.Submit(ImageJob{URL: fmt.Sprintf("%s/slow-%d.jpg", server.URL, i), Index: i})
+	}
+
+	time.AfterFunc(100*time.Millisecond, cancel)
+	time.Sleep(150 * time.Millisecond)
+
+	if pool.Submit(ImageJob{URL: server.URL + "/late.jpg"}) {
+		t.Error("Submit should be rejected after the context is cancelled")
+	}
+	pool.Close()
+
+	start := time.Now()
+	for res := range pool.Results() {
+		if res.Err == nil {
+			t.Errorf("Job %d should fail after cancellation", res.Job.Index)
+		}
+	}
+	if time.Since(start) > 3*time.Second {
+		t.Errorf("Pool should drain promptly after cancellation, took %v", time.Since(start))
+	}
+}
@@ -0,0 +1,103 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// QuarantineRoot is where retired image files are moved on local storage.
+// When empty, MediaRoot/quarantine is used. Other backends move them under
+// the quarantine/ prefix of the same store.
+var QuarantineRoot = os.Getenv("MEDIA_QUARANTINE_ROOT")
+
+func quarantineRoot(local *LocalStorage) string {
+	if QuarantineRoot != "" {
+		return QuarantineRoot
+	}
+	return filepath.Join(local.root(), "quarantine")
+}
+
+// QuarantineImage moves an image file and its variants out of the media root
+// into a dated directory under QuarantineRoot, keeping their relative paths.
+// It returns the new location of the original, or "" if it was already gone.
+func QuarantineImage(ctx context.Context, imagePath string) (string, error) {
+	if imagePath == "" {
+		return "", nil
+	}
+
+	day := time.Now().Format("2006-01-02")
+
+	dst, err := quarantineFile(ctx, imagePath, day)
+	if err != nil {
+		return "", err
+	}
+
+	// Variants are moved even when the original is already gone
+	var errs []error
+	for _, v := range Variants {
+		if _, err := quarantineFile(ctx, VariantPath(imagePath, v.Name), day); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return dst, errors.Join(errs...)
+}
+
+// QuarantineFile moves a single file, without its variants, like QuarantineImage
+func QuarantineFile(ctx context.Context, path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	return quarantineFile(ctx, path, time.Now().Format("2006-01-02"))
+}
+
+// quarantineFile moves one file to the quarantine of day and returns its new
+// location, or "" if the file was already gone
+func quarantineFile(ctx context.Context, imagePath, day string) (string, error) {
+	local, ok := Store.(*LocalStorage)
+	if !ok {
+		return quarantineInStore(ctx, imagePath, day)
+	}
+
+	src := local.fullPath(imagePath)
+	if _, err := os.Stat(src); errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+
+	dst := filepath.Join(quarantineRoot(local), day, imagePath)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return "", fmt.Errorf("mkdir failed %s: %w", filepath.Dir(dst), err)
+	}
+
+	if err := os.Rename(src, dst); err != nil {
+		return "", fmt.Errorf("quarantine failed %s: %w", src, err)
+	}
+
+	return dst, nil
+}
+
+// quarantineInStore copies the file to quarantine/<day>/<path> in Store and
+// removes the original
+func quarantineInStore(ctx context.Context, imagePath, day string) (string, error) {
+	data, err := Store.Get(ctx, imagePath)
+	if IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("quarantine failed %s: %w", imagePath, err)
+	}
+
+	dst := "quarantine/" + day + "/" + imagePath
+	if err := Store.Put(ctx, dst, data); err != nil {
+		return "", fmt.Errorf("quarantine failed %s: %w", imagePath, err)
+	}
+	if err := Store.Delete(ctx, imagePath); err != nil {
+		return "", fmt.Errorf("quarantine failed %s: %w", imagePath, err)
+	}
+
+	return dst, nil
+}
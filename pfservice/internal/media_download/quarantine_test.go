@@ -0,0 +1,113 @@
+package media
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestQuarantineImage(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "pf-service-test-media-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	oldMediaRoot := MediaRoot
+	MediaRoot = tmpDir
+	defer func() {
+		MediaRoot = oldMediaRoot
+	}()
+
+	oldVariants := Variants
+	Variants = []Variant{{Name: "thumb", MaxSize: 320}, {Name: "large", MaxSize: 1600}}
+	defer func() {
+		Variants = oldVariants
+	}()
+
+	imagePath := filepath.Join("property_images", "old.jpg")
+	os.MkdirAll(filepath.Join(tmpDir, "property_images"), 0755)
+	for _, p := range []string{imagePath, VariantPath(imagePath, "thumb"), VariantPath(imagePath, "large")} {
+		if err := os.WriteFile(filepath.Join(tmpDir, p), []byte{0xFF, 0xD8}, 0644); err != nil {
+			t.Fatalf("Failed to create test image: %v", err)
+		}
+	}
+
+	dst, err := QuarantineImage(context.Background(), imagePath)
+	if err != nil {
+		t.Fatalf("QuarantineImage failed: %v", err)
+	}
+
+	if ImageExists(context.Background(), imagePath) {
+		t.Error("Image should no longer be in MEDIA_ROOT")
+	}
+	if !strings.HasPrefix(dst, filepath.Join(tmpDir, "quarantine")) || !strings.HasSuffix(dst, imagePath) {
+		t.Errorf("Unexpected quarantine path %s", dst)
+	}
+	if _, err := os.Stat(dst); err != nil {
+		t.Errorf("Quarantined file missing: %v", err)
+	}
+
+	// No variant is left behind in MEDIA_ROOT
+	left, err := os.ReadDir(filepath.Join(tmpDir, "property_images"))
+	if err != nil {
+		t.Fatalf("Failed to list media: %v", err)
+	}
+	for _, f := range left {
+		t.Errorf("File left in MEDIA_ROOT after quarantine: %s", f.Name())
+	}
+	for _, name := range []string{"thumb", "large"} {
+		variant := filepath.Join(filepath.Dir(dst), filepath.Base(VariantPath(imagePath, name)))
+		if _, err := os.Stat(variant); err != nil {
+			t.Errorf("Quarantined %s variant missing: %v", name, err)
+		}
+	}
+
+	// A file that is already gone is not an error
+	dst, err = QuarantineImage(context.Background(), imagePath)
+	if err != nil || dst != "" {
+		t.Errorf("Expected no-op for missing file, got %q, %v", dst, err)
+	}
+}
+
+func TestQuarantineImageInS3(t *testing.T) {
+	fake, server := newFakeS3(t, "media")
+	defer server.Close()
+
+	oldStore := Store
+	Store = &S3Storage{
+		Endpoint:        server.URL,
+		Region:          "us-east-1",
+		Bucket:          "media",
+		AccessKeyID:     "test-key",
+		SecretAccessKey: "test-secret",
+		Client:          server.Client(),
+	}
+	defer func() {
+		Store = oldStore
+	}()
+
+	ctx := context.Background()
+	imagePath := "property_images/abc.jpg"
+	if err := Store.Put(ctx, imagePath, []byte{0xFF, 0xD8}); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	dst, err := QuarantineImage(ctx, imagePath)
+	if err != nil {
+		t.Fatalf("QuarantineImage failed: %v", err)
+	}
+	if !strings.HasPrefix(dst, "quarantine/") || !strings.HasSuffix(dst, imagePath) {
+		t.Errorf("Unexpected quarantine key %s", dst)
+	}
+
+	fake.mu.Lock()
+	_, original := fake.objects[imagePath]
+	_, moved := fake.objects[dst]
+	fake.mu.Unlock()
+	if original || !moved {
+		t.Errorf("Expected %s moved to %s, original kept: %v, moved: %v", imagePath, dst, original, moved)
+	}
+}
@@ -0,0 +1,63 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// Storage is where media files are kept. Paths are relative to the media root
+// and use forward slashes, e.g. property_images/<hash>.jpg, the same value
+// stored in core_app_propertyimage.image.
+type Storage interface {
+	// Put stores data at path, replacing any existing file. A file is never
+	// visible at path before it is complete.
+	Put(ctx context.Context, path string, data []byte) error
+	// Get returns the content of path; a missing file is fs.ErrNotExist
+	Get(ctx context.Context, path string) ([]byte, error)
+	Exists(ctx context.Context, path string) (bool, error)
+	// Stat describes path; a missing file is fs.ErrNotExist
+	Stat(ctx context.Context, path string) (FileInfo, error)
+	// Delete removes path; deleting a missing file is not an error
+	Delete(ctx context.Context, path string) error
+	// List calls fn for every file under prefix, in no particular order,
+	// and stops at the first error fn returns
+	List(ctx context.Context, prefix string, fn func(FileInfo) error) error
+}
+
+// FileInfo describes a stored file
+type FileInfo struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+}
+
+// Store is the storage used for all media files. It is local disk under
+// MediaRoot until ConfigureStorage selects another backend.
+var Store Storage = &LocalStorage{}
+
+// ConfigureStorage sets Store from MEDIA_STORAGE: "local" (default) or "s3".
+// It is called once at startup, after the configuration is loaded.
+func ConfigureStorage() error {
+	switch backend := os.Getenv("MEDIA_STORAGE"); backend {
+	case "", "local":
+		Store = &LocalStorage{}
+	case "s3":
+		s3, err := NewS3StorageFromEnv()
+		if err != nil {
+			return err
+		}
+		Store = s3
+	default:
+		return fmt.Errorf("unknown MEDIA_STORAGE %q, expected local or s3", backend)
+	}
+	return nil
+}
+
+// IsNotExist reports whether err means the file does not exist
+func IsNotExist(err error) bool {
+	return errors.Is(err, fs.ErrNotExist)
+}
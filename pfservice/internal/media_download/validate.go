@@ -0,0 +1,99 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/http"
+	"strings"
+
+	_ "golang.org/x/image/webp"
+)
+
+// ErrInvalidImage is returned for downloads that are not a complete jpg, png or webp image
+var ErrInvalidImage = errors.New("invalid image")
+
+const (
+	// Smaller images are tracking pixels or placeholders, not listing photos
+	minImageDimension = 16
+	maxImageDimension = 20000
+	// Decoding holds 4 bytes per pixel in memory, about 200 MB at this size
+	maxImagePixels = 50_000_000
+)
+
+// jpegTrailerWindow is how far from the end of a JPEG its EOI marker may be
+const jpegTrailerWindow = 16 << 10
+
+// imageExtensions maps image.DecodeConfig format names to stored file extensions
+var imageExtensions = map[string]string{
+	"jpeg": ".jpg",
+	"png":  ".png",
+	"webp": ".webp",
+}
+
+// validateImage checks that data is a complete jpg, png or webp image with sane
+// dimensions and returns the file extension for its real format
+func validateImage(data []byte) (string, error) {
+	contentType := http.DetectContentType(data)
+	if !strings.HasPrefix(contentType, "image/") {
+		return "", fmt.Errorf("%w: content type %s", ErrInvalidImage, contentType)
+	}
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: %v", ErrInvalidImage, contentType, err)
+	}
+
+	ext, ok := imageExtensions[format]
+	if !ok {
+		return "", fmt.Errorf("%w: unsupported format %s", ErrInvalidImage, format)
+	}
+
+	if cfg.Width < minImageDimension || cfg.Height < minImageDimension ||
+		cfg.Width > maxImageDimension || cfg.Height > maxImageDimension {
+		return "", fmt.Errorf("%w: dimensions %dx%d", ErrInvalidImage, cfg.Width, cfg.Height)
+	}
+	if err := checkPixels(cfg); err != nil {
+		return "", err
+	}
+
+	// The header decodes even when the rest of the file is cut off
+	if !isComplete(format, data) {
+		return "", fmt.Errorf("%w: truncated %s", ErrInvalidImage, format)
+	}
+
+	return ext, nil
+}
+
+// checkPixels rejects images too large to decode in memory
+func checkPixels(cfg image.Config) error {
+	if int64(cfg.Width)*int64(cfg.Height) > maxImagePixels {
+		return fmt.Errorf("%w: %dx%d is more than %d pixels", ErrInvalidImage, cfg.Width, cfg.Height, maxImagePixels)
+	}
+	return nil
+}
+
+// isComplete checks the end-of-file marker of each format
+func isComplete(format string, data []byte) bool {
+	switch format {
+	case "jpeg":
+		// EOI marker; cameras and CDNs may append padding or metadata after it
+		tail := data[max(0, len(data)-jpegTrailerWindow):]
+		return bytes.Contains(tail, []byte{0xFF, 0xD9})
+	case "png":
+		// IEND chunk: length 0, type, CRC
+		return bytes.HasSuffix(data, []byte{0, 0, 0, 0, 'I', 'E', 'N', 'D', 0xAE, 0x42, 0x60, 0x82})
+	case "webp":
+		// RIFF size covers everything after the first 8 bytes
+		if len(data) < 12 {
+			return false
+		}
+		size := binary.LittleEndian.Uint32(data[4:8])
+		return int64(size)+8 <= int64(len(data))
+	}
+	return false
+}
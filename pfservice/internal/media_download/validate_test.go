@@ -0,0 +1,97 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// testJPEG encodes a solid w x h JPEG; different shades give different content
+func testJPEG(t *testing.T, w, h int, shade uint8) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(w, h, shade), nil); err != nil {
+		t.Fatalf("Failed to encode JPEG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// testPNG encodes a solid w x h PNG
+func testPNG(t *testing.T, w, h int, shade uint8) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage(w, h, shade)); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// withPNGSize rewrites the dimensions in the IHDR chunk of a PNG, so a huge
+// image can be tested without encoding one
+func withPNGSize(data []byte, w, h int) []byte {
+	out := append([]byte(nil), data...)
+	binary.BigEndian.PutUint32(out[16:20], uint32(w))
+	binary.BigEndian.PutUint32(out[20:24], uint32(h))
+	binary.BigEndian.PutUint32(out[29:33], crc32.ChecksumIEEE(out[12:29]))
+	return out
+}
+
+func testImage(w, h int, shade uint8) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{shade, shade, shade, 255})
+		}
+	}
+	return img
+}
+
+func TestValidateImage(t *testing.T) {
+	jpg := testJPEG(t, 64, 48, 100)
+	pngData := testPNG(t, 64, 48, 100)
+	// Smallest valid lossless WebP: 1x1, used for the format check only
+	tinyWebP := []byte("RIFF\x1a\x00\x00\x00WEBPVP8L\x0d\x00\x00\x00\x2f\x00\x00\x00\x10\x07\x10\x11\x11\x88\x88\xfe\x07\x00")
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantExt string
+		wantErr bool
+	}{
+		{"jpeg", jpg, ".jpg", false},
+		{"png", pngData, ".png", false},
+		{"html error page", []byte("<!DOCTYPE html><html><body>502 Bad Gateway</body></html>"), "", true},
+		{"jpeg header only", []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x10, 0x4A, 0x46, 0x49, 0x46}, "", true},
+		{"truncated jpeg", jpg[:len(jpg)/2], "", true},
+		{"jpeg with trailing bytes", append(append([]byte(nil), jpg...), bytes.Repeat([]byte("trailer\xff"), 256)...), ".jpg", false},
+		{"truncated png", pngData[:len(pngData)-12], "", true},
+		{"tracking pixel", testPNG(t, 1, 1, 0), "", true},
+		{"too many pixels", withPNGSize(pngData, 10000, 10000), "", true},
+		{"within pixel limit", withPNGSize(pngData, 5000, 5000), ".png", false},
+		{"webp too small", tinyWebP, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ext, err := validateImage(tt.data)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidImage) {
+					t.Errorf("Expected ErrInvalidImage, got ext %q, err %v", ext, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if ext != tt.wantExt {
+				t.Errorf("Expected extension %s, got %s", tt.wantExt, ext)
+			}
+		})
+	}
+}
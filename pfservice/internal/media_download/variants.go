@@ -0,0 +1,188 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// DefaultVariants is used when IMAGE_VARIANTS is not set
+const DefaultVariants = "thumb:320,medium:800,large:1600"
+
+// variantJPEGQuality balances size and quality for listing photos
+const variantJPEGQuality = 85
+
+// Variant is a resized copy of each image that fits in MaxSize x MaxSize pixels
+type Variant struct {
+	Name    string
+	MaxSize int
+}
+
+// Variants are generated after each download. IMAGE_VARIANTS lists them as
+// name:size pairs, e.g. "thumb:320,medium:800"; "none" disables them.
+var Variants = getVariants()
+
+func getVariants() []Variant {
+	spec, ok := os.LookupEnv("IMAGE_VARIANTS")
+	if !ok {
+		spec = DefaultVariants
+	}
+	variants, err := ParseVariants(spec)
+	if err != nil {
+		log.Printf("Invalid IMAGE_VARIANTS %q, using %q: %v", spec, DefaultVariants, err)
+		variants, _ = ParseVariants(DefaultVariants)
+	}
+	return variants
+}
+
+// ParseVariants parses a comma separated list of name:size pairs.
+// An empty list or "none" means no variants.
+func ParseVariants(spec string) ([]Variant, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" || spec == "none" {
+		return nil, nil
+	}
+
+	var variants []Variant
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(spec, ",") {
+		name, size, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("variant %q is not name:size", part)
+		}
+		// The name is part of the filename
+		if strings.ContainsAny(name, `/\. `) {
+			return nil, fmt.Errorf("variant name %q must not contain /, \\, . or spaces", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("variant %q listed twice", name)
+		}
+		maxSize, err := strconv.Atoi(size)
+		if err != nil || maxSize < minImageDimension || maxSize > maxImageDimension {
+			return nil, fmt.Errorf("variant %q size must be between %d and %d", name, minImageDimension, maxImageDimension)
+		}
+		seen[name] = true
+		variants = append(variants, Variant{Name: name, MaxSize: maxSize})
+	}
+	return variants, nil
+}
+
+// VariantPath returns the relative path of an image's variant:
+// property_images/<hash>.jpg becomes property_images/<hash>_thumb.jpg.
+// PNG images keep PNG variants for transparency; all others are JPEG.
+func VariantPath(imagePath, name string) string {
+	ext := filepath.Ext(imagePath)
+	stem := strings.TrimSuffix(imagePath, ext)
+	if !strings.EqualFold(ext, ".png") {
+		ext = ".jpg"
+	}
+	return stem + "_" + name + ext
+}
+
+// MissingVariants returns the configured variants of imagePath whose file does not exist
+func MissingVariants(ctx context.Context, imagePath string) ([]Variant, error) {
+	var missing []Variant
+	for _, v := range Variants {
+		ok, err := Store.Exists(ctx, VariantPath(imagePath, v.Name))
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			missing = append(missing, v)
+		}
+	}
+	return missing, nil
+}
+
+// GenerateVariants creates the missing variants of a stored image from the
+// original file and returns how many were written
+func GenerateVariants(ctx context.Context, imagePath string) (int, error) {
+	missing, err := MissingVariants(ctx, imagePath)
+	if err != nil {
+		return 0, fmt.Errorf("check variants of %s: %w", imagePath, err)
+	}
+	if len(missing) == 0 {
+		return 0, nil
+	}
+
+	data, err := Store.Get(ctx, imagePath)
+	if err != nil {
+		return 0, fmt.Errorf("read original %s: %w", imagePath, err)
+	}
+
+	// Originals stored before the pixel limit may be too large to decode
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, fmt.Errorf("decode original %s: %w", imagePath, err)
+	}
+	if err := checkPixels(cfg); err != nil {
+		return 0, fmt.Errorf("decode original %s: %w", imagePath, err)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 0, fmt.Errorf("decode original %s: %w", imagePath, err)
+	}
+
+	written := 0
+	var errs []error
+	for _, v := range missing {
+		variantPath := VariantPath(imagePath, v.Name)
+		encoded, err := encodeVariant(resizeToFit(src, v.MaxSize), variantPath)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("encode %s: %w", variantPath, err))
+			continue
+		}
+		if err := Store.Put(ctx, variantPath, encoded); err != nil {
+			errs = append(errs, fmt.Errorf("store %s: %w", variantPath, err))
+			continue
+		}
+		written++
+	}
+
+	return written, errors.Join(errs...)
+}
+
+// resizeToFit scales src down to fit in maxSize x maxSize, keeping its aspect
+// ratio. Smaller images are returned as they are.
+func resizeToFit(src image.Image, maxSize int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= maxSize && h <= maxSize {
+		return src
+	}
+
+	if w >= h {
+		h = max(1, h*maxSize/w)
+		w = maxSize
+	} else {
+		w = max(1, w*maxSize/h)
+		h = maxSize
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, b, draw.Src, nil)
+	return dst
+}
+
+func encodeVariant(img image.Image, variantPath string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	if filepath.Ext(variantPath) == ".png" {
+		err = png.Encode(&buf, img)
+	} else {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: variantJPEGQuality})
+	}
+	return buf.Bytes(), err
+}
@@ -0,0 +1,109 @@
+package media
+
+import (
+	"context"
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseVariants(t *testing.T) {
+	variants, err := ParseVariants(DefaultVariants)
+	if err != nil {
+		t.Fatalf("Default variants should parse: %v", err)
+	}
+	want := []Variant{{"thumb", 320}, {"medium", 800}, {"large", 1600}}
+	if len(variants) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, variants)
+	}
+	for i := range want {
+		if variants[i] != want[i] {
+			t.Errorf("Expected %v, got %v", want[i], variants[i])
+		}
+	}
+
+	for _, spec := range []string{"", "none"} {
+		if v, err := ParseVariants(spec); err != nil || len(v) != 0 {
+			t.Errorf("ParseVariants(%q) = %v, %v; want no variants", spec, v, err)
+		}
+	}
+
+	for _, spec := range []string{"thumb", "thumb:abc", "thumb:0", "../x:320", "thumb:320,thumb:640"} {
+		if _, err := ParseVariants(spec); err == nil {
+			t.Errorf("ParseVariants(%q) should fail", spec)
+		}
+	}
+}
+
+func TestVariantPath(t *testing.T) {
+	tests := []struct {
+		path, want string
+	}{
+		{"property_images/abc.jpg", "property_images/abc_thumb.jpg"},
+		{"property_images/abc.png", "property_images/abc_thumb.png"},
+		{"property_images/abc.webp", "property_images/abc_thumb.jpg"},
+	}
+	for _, tt := range tests {
+		if got := VariantPath(tt.path, "thumb"); got != tt.want {
+			t.Errorf("VariantPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateVariants(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	oldMediaRoot := MediaRoot
+	MediaRoot = tmpDir
+	oldVariants := Variants
+	Variants = []Variant{{"thumb", 32}, {"large", 400}}
+	defer func() {
+		MediaRoot = oldMediaRoot
+		Variants = oldVariants
+	}()
+
+	ctx := context.Background()
+	imagePath := "property_images/abc.jpg"
+	fullPath := filepath.Join(tmpDir, imagePath)
+	os.MkdirAll(filepath.Dir(fullPath), 0755)
+	if err := os.WriteFile(fullPath, testJPEG(t, 200, 100, 100), 0644); err != nil {
+		t.Fatalf("Failed to write original: %v", err)
+	}
+
+	if missing, err := MissingVariants(ctx, imagePath); err != nil || len(missing) != 2 {
+		t.Fatalf("Expected 2 missing variants, got %v, %v", missing, err)
+	}
+
+	written, err := GenerateVariants(ctx, imagePath)
+	if err != nil || written != 2 {
+		t.Fatalf("GenerateVariants = %d, %v; want 2, nil", written, err)
+	}
+
+	// The thumbnail is scaled to fit, the large variant is not upscaled
+	sizes := map[string]image.Point{"thumb": {32, 16}, "large": {200, 100}}
+	for name, want := range sizes {
+		f, err := os.Open(GetFullImagePath(VariantPath(imagePath, name)))
+		if err != nil {
+			t.Fatalf("Variant %s missing: %v", name, err)
+		}
+		cfg, _, err := image.DecodeConfig(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("Variant %s is not an image: %v", name, err)
+		}
+		if cfg.Width != want.X || cfg.Height != want.Y {
+			t.Errorf("Variant %s is %dx%d, want %dx%d", name, cfg.Width, cfg.Height, want.X, want.Y)
+		}
+	}
+
+	// Only missing variants are regenerated
+	os.Remove(GetFullImagePath(VariantPath(imagePath, "thumb")))
+	written, err = GenerateVariants(ctx, imagePath)
+	if err != nil || written != 1 {
+		t.Errorf("GenerateVariants = %d, %v; want 1, nil", written, err)
+	}
+	if missing, _ := MissingVariants(ctx, imagePath); len(missing) != 0 {
+		t.Error("Expected no missing variants after regeneration")
+	}
+}
@@ -0,0 +1,133 @@
+package plan
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// Plan lists the writes a run would make; it is produced by --dry-run
+type Plan struct {
+	Command     string    `json:"command"`
+	GeneratedAt time.Time `json:"generated_at"`
+
+	// Complete is false when listings pagination stopped early,
+	// in which case no hides are planned
+	Complete bool `json:"complete"`
+	// Targeted is set when only listings selected by pf_id or reference
+	// were fetched
+	Targeted bool `json:"targeted,omitempty"`
+	// UpdatedSince is the watermark of an incremental run; only listings
+	// updated since then were fetched
+	UpdatedSince *time.Time `json:"updated_since,omitempty"`
+
+	Users      []Change `json:"users"`
+	Properties []Change `json:"properties"`
+	Hides      []string `json:"hides"`
+	// HideSkipped explains why the hide step would not run
+	HideSkipped string  `json:"hide_skipped,omitempty"`
+	Images      []Image `json:"images"`
+	Skipped     []Skip  `json:"skipped"`
+
+	Summary Summary `json:"summary"`
+}
+
+// Change is a record that would be created or updated
+type Change struct {
+	Action string   `json:"action"`
+	Key    string   `json:"key"`
+	Fields []string `json:"fields,omitempty"`
+}
+
+// Image is an image that would be downloaded or retired
+type Image struct {
+	// Action is "download" for a new image record, "redownload" to replace
+	// the file of an existing record, "retire" for an image removed from
+	// the listing and "variants" to regenerate resized copies from the file
+	Action     string `json:"action"`
+	PfID       string `json:"pf_id"`
+	PropertyID uint   `json:"property_id,omitempty"`
+	ImageID    uint   `json:"image_id,omitempty"`
+	URL        string `json:"url,omitempty"`
+	// Path is the image record's current file; new downloads have none yet
+	Path string `json:"path,omitempty"`
+	// Variants are the names of the variants to regenerate
+	Variants []string `json:"variants,omitempty"`
+}
+
+// Skip is a listing or image that would not be processed
+type Skip struct {
+	Key    string `json:"key"`
+	Reason string `json:"reason"`
+}
+
+type Summary struct {
+	UsersCreated      int `json:"users_created"`
+	UsersUpdated      int `json:"users_updated"`
+	PropertiesCreated int `json:"properties_created"`
+	PropertiesUpdated int `json:"properties_updated"`
+	PropertiesHidden  int `json:"properties_hidden"`
+	ImageDownloads    int `json:"image_downloads"`
+	ImagesRetired     int `json:"images_retired"`
+	VariantImages     int `json:"variant_images"`
+	Skipped           int `json:"skipped"`
+}
+
+// New returns an empty plan for command
+func New(command string) *Plan {
+	return &Plan{
+		Command:     command,
+		GeneratedAt: time.Now().UTC(),
+		Users:       []Change{},
+		Properties:  []Change{},
+		Hides:       []string{},
+		Images:      []Image{},
+		Skipped:     []Skip{},
+	}
+}
+
+// Write fills in the summary and writes the plan to w as indented JSON
+func (p *Plan) Write(w io.Writer) error {
+	p.Summary = p.summarize()
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(p)
+}
+
+func (p *Plan) summarize() Summary {
+	var s Summary
+
+	for _, c := range p.Users {
+		switch c.Action {
+		case "create":
+			s.UsersCreated++
+		case "update":
+			s.UsersUpdated++
+		}
+	}
+	for _, c := range p.Properties {
+		switch c.Action {
+		case "create":
+			s.PropertiesCreated++
+		case "update":
+			s.PropertiesUpdated++
+		}
+	}
+	if p.HideSkipped == "" {
+		s.PropertiesHidden = len(p.Hides)
+	}
+	for _, img := range p.Images {
+		switch img.Action {
+		case "retire":
+			s.ImagesRetired++
+		case "variants":
+			s.VariantImages++
+		default:
+			s.ImageDownloads++
+		}
+	}
+	s.Skipped = len(p.Skipped)
+
+	return s
+}
@@ -0,0 +1,57 @@
+package plan
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestWriteSummary(t *testing.T) {
+	p := New("pf_sync")
+	p.Users = append(p.Users, Change{Action: "create", Key: "a@example.com"})
+	p.Properties = append(p.Properties,
+		Change{Action: "create", Key: "pf-1"},
+		Change{Action: "update", Key: "pf-2", Fields: []string{"price"}},
+	)
+	p.Hides = append(p.Hides, "pf-3")
+	p.Images = append(p.Images,
+		Image{Action: "download", PfID: "pf-1", URL: "http://x/a.jpg"},
+		Image{Action: "variants", PfID: "pf-2", Path: "property_images/b.jpg", Variants: []string{"thumb"}},
+	)
+
+	var buf bytes.Buffer
+	if err := p.Write(&buf); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	var decoded Plan
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Plan is not valid JSON: %v", err)
+	}
+
+	want := Summary{
+		UsersCreated:      1,
+		PropertiesCreated: 1,
+		PropertiesUpdated: 1,
+		PropertiesHidden:  1,
+		ImageDownloads:    1,
+		VariantImages:     1,
+	}
+	if decoded.Summary != want {
+		t.Errorf("Expected summary %+v, got %+v", want, decoded.Summary)
+	}
+}
+
+func TestWriteSkippedHides(t *testing.T) {
+	p := New("pf_sync")
+	p.Hides = append(p.Hides, "pf-1", "pf-2")
+	p.HideSkipped = "hide threshold exceeded"
+
+	var buf bytes.Buffer
+	if err := p.Write(&buf); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if p.Summary.PropertiesHidden != 0 {
+		t.Errorf("Expected no hides counted when the step is skipped, got %d", p.Summary.PropertiesHidden)
+	}
+}
@@ -0,0 +1,99 @@
+package property
+
+import (
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// PropertyImageSource links an image record to the Property Finder image it was
+// downloaded from. It lives in its own table so the Django schema is unchanged.
+type PropertyImageSource struct {
+	ImageID    uint   `gorm:"column:image_id;primaryKey;autoIncrement:false"`
+	PropertyID uint   `gorm:"column:property_id;index"`
+	SourceURL  string `gorm:"column:source_url"`
+	MediaKey   string `gorm:"column:media_key;index"`
+	// ContentHash is the SHA-256 of the stored file, which is also its name
+	ContentHash string `gorm:"column:content_hash;index"`
+	// Position is the image's index in the listing on Property Finder
+	Position int `gorm:"column:position;not null;default:0"`
+	// IsPrimary marks the listing's cover image, the first one on Property Finder
+	IsPrimary bool `gorm:"column:is_primary;not null;default:false"`
+	// RetiredAt is set when the image was removed from the listing on
+	// Property Finder and the retire policy is "flag"
+	RetiredAt *time.Time `gorm:"column:retired_at"`
+	CreatedAt time.Time  `gorm:"column:created_at"`
+	UpdatedAt time.Time  `gorm:"column:updated_at"`
+}
+
+func (PropertyImageSource) TableName() string {
+	return "pf_property_image_source"
+}
+
+// MediaKey returns the Property Finder media UUID in an image URL, or "" if there is none.
+// URLs look like /media/images/listing/ID/<uuid>/original.jpg or /media/tmp/<dir>/<uuid>_original.jpg
+func MediaKey(rawURL string) string {
+	urlPath := rawURL
+	if u, err := url.Parse(rawURL); err == nil {
+		urlPath = u.Path
+	}
+
+	// Look for UUID-like strings in the path (contains dashes, 30+ chars),
+	// starting from the end
+	parts := strings.Split(strings.Trim(urlPath, "/"), "/")
+	for i := len(parts) - 1; i >= 0; i-- {
+		part := parts[i]
+		if !strings.Contains(part, "-") || len(part) < 30 {
+			continue
+		}
+		// If part contains _original.jpg or similar, extract just the UUID part
+		if strings.Contains(part, "_original") {
+			uuidPart := strings.Split(part, "_")[0]
+			if len(uuidPart) >= 30 && strings.Contains(uuidPart, "-") {
+				return uuidPart
+			}
+			continue
+		}
+		return part
+	}
+
+	return ""
+}
+
+// ImageMediaKey returns the Property Finder media UUID an image was downloaded
+// from: the one on its source record, or for older records without a source,
+// the UUID in its filename. It is "" when neither is known.
+func ImageMediaKey(img DjangoPropertyImage, src *PropertyImageSource) string {
+	if src != nil {
+		return src.MediaKey
+	}
+	return MediaKey(strings.TrimSuffix(path.Base(img.Image), path.Ext(img.Image)))
+}
+
+// MatchImageURL returns the index in urls of the image that img was downloaded
+// from, or -1 if none of them is. With a source record the stored URL, then its
+// media key, is matched; older records without one are matched by the media
+// UUID in their filename.
+func MatchImageURL(img DjangoPropertyImage, src *PropertyImageSource, urls []string) int {
+	if src != nil {
+		for i, u := range urls {
+			if u != "" && u == src.SourceURL {
+				return i
+			}
+		}
+	}
+
+	key := ImageMediaKey(img, src)
+	if key == "" {
+		return -1
+	}
+
+	for i, u := range urls {
+		if u != "" && MediaKey(u) == key {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,53 @@
+package property
+
+import "testing"
+
+func TestMediaKey(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://pf.example/media/images/listing/Z1XHGC2QB0ARA317TMC2F5K2ZW/ce5950dd-d4b0-478e-ad32-176b8900bef1/original.jpg?w=1", "ce5950dd-d4b0-478e-ad32-176b8900bef1"},
+		{"https://pf.example/media/tmp/979aa4e2-0ce0-4717-b230-81a2babeeac6/f4440543-f51c-4227-bb92-6b24bbf466a3_original.jpg", "f4440543-f51c-4227-bb92-6b24bbf466a3"},
+		{"https://pf.example/media/images/listing/ID1/original.jpg", ""},
+	}
+
+	for _, tt := range tests {
+		if got := MediaKey(tt.url); got != tt.want {
+			t.Errorf("MediaKey(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestMatchImageURL(t *testing.T) {
+	urls := []string{
+		"https://pf.example/media/images/listing/ID/ce5950dd-d4b0-478e-ad32-176b8900bef1/original.jpg",
+		"",
+		"https://pf.example/media/images/listing/ID/991f8733-ac63-4b7b-8a44-d8586cae82a0/original.jpg?sig=new",
+		"https://pf.example/media/images/listing/ID/741275b0-4d08-4129-a86c-7a69537e7aba/original.jpg",
+	}
+
+	// Exact source URL
+	src := &PropertyImageSource{SourceURL: urls[3], MediaKey: "741275b0-4d08-4129-a86c-7a69537e7aba"}
+	if got := MatchImageURL(DjangoPropertyImage{Image: "property_images/x.jpg"}, src, urls); got != 3 {
+		t.Errorf("Expected exact URL match at 3, got %d", got)
+	}
+
+	// Same media, URL changed since the download
+	src = &PropertyImageSource{SourceURL: "https://pf.example/old", MediaKey: "991f8733-ac63-4b7b-8a44-d8586cae82a0"}
+	if got := MatchImageURL(DjangoPropertyImage{Image: "property_images/x.jpg"}, src, urls); got != 2 {
+		t.Errorf("Expected media key match at 2, got %d", got)
+	}
+
+	// Legacy record without a source, matched by its filename
+	legacy := DjangoPropertyImage{Image: "property_images/741275b0-4d08-4129-a86c-7a69537e7aba.jpg"}
+	if got := MatchImageURL(legacy, nil, urls); got != 3 {
+		t.Errorf("Expected filename match at 3, got %d", got)
+	}
+
+	// Photo no longer in the listing: no fallback to another image
+	gone := DjangoPropertyImage{Image: "property_images/00000000-0000-0000-0000-000000000000.jpg"}
+	if got := MatchImageURL(gone, nil, urls); got != -1 {
+		t.Errorf("Expected no match, got %d", got)
+	}
+}
@@ -0,0 +1,344 @@
+// Package repair restores missing image files and variants. It is shared by
+// pf_repair and pf_check --repair.
+package repair
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"pfservice/internal/db"
+	"pfservice/internal/httpclient"
+	media "pfservice/internal/media_download"
+	"pfservice/internal/plan"
+	"pfservice/internal/property"
+	"sort"
+	"strconv"
+	"sync/atomic"
+
+	"gorm.io/gorm"
+)
+
+// Result counts what a repair run did
+type Result struct {
+	ImagesRepaired int
+	ImagesFailed   int
+	// VariantsGenerated counts variant files, VariantsFailed counts images
+	VariantsGenerated int
+	VariantsFailed    int
+}
+
+// Prepare creates the image source table and removes temp files left by
+// interrupted downloads. It is skipped in dry-run mode.
+func Prepare(ctx context.Context, dbConn *gorm.DB) error {
+	if err := db.Migrate(ctx, dbConn); err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+
+	swept, err := media.SweepTempFiles(media.TempFileMaxAge)
+	if err != nil {
+		log.Printf("Warning: Failed to sweep temp image files: %v", err)
+	} else if swept > 0 {
+		log.Printf("Removed %d orphaned temp image files", swept)
+	}
+	return nil
+}
+
+// Variants regenerates the missing variants from the original files; no
+// download is needed. With a plan they are added to it instead.
+func Variants(ctx context.Context, missingVariants []db.MissingVariantInfo, repairPlan *plan.Plan) Result {
+	var result Result
+	if len(missingVariants) == 0 {
+		return result
+	}
+
+	if repairPlan != nil {
+		for _, missing := range missingVariants {
+			repairPlan.Images = append(repairPlan.Images, plan.Image{
+				Action:     "variants",
+				PfID:       missing.PfID,
+				PropertyID: missing.PropertyID,
+				ImageID:    missing.ImageID,
+				Path:       missing.ImagePath,
+				Variants:   missing.Variants,
+			})
+		}
+		return result
+	}
+
+	log.Printf("Found %d images with missing variants. Regenerating...", len(missingVariants))
+
+	for _, missing := range missingVariants {
+		if ctx.Err() != nil {
+			break
+		}
+		n, err := media.GenerateVariants(ctx, missing.ImagePath)
+		result.VariantsGenerated += n
+		if err != nil {
+			log.Printf("Failed to generate variants for property %d, image %s: %v", missing.PropertyID, missing.ImagePath, err)
+			result.VariantsFailed++
+		}
+	}
+
+	log.Printf("VARIANTS REPAIRED: %d variants generated, %d images failed", result.VariantsGenerated, result.VariantsFailed)
+	return result
+}
+
+// Images re-downloads missing image files from their Property Finder listing
+// and points the records at the new files. With a plan the re-downloads are
+// added to it instead. An error means the repair could not start.
+func Images(ctx context.Context, dbConn *gorm.DB, client *httpclient.Client, missingImages []db.MissingImageInfo, repairPlan *plan.Plan) (Result, error) {
+	var result Result
+	if len(missingImages) == 0 {
+		if repairPlan != nil {
+			repairPlan.Complete = true
+		}
+		return result, nil
+	}
+
+	log.Printf("Found %d missing images. Starting repair...", len(missingImages))
+
+	// Get JWT token
+	if _, err := client.Token(ctx); err != nil {
+		return result, fmt.Errorf("token error: %w", err)
+	}
+
+	// Group missing images by property
+	missingByProperty := make(map[uint][]db.MissingImageInfo)
+	pfIDs := make(map[string]bool)
+	for _, missing := range missingImages {
+		missingByProperty[missing.PropertyID] = append(missingByProperty[missing.PropertyID], missing)
+		pfIDs[missing.PfID] = true
+	}
+
+	log.Printf("Fetching listings for %d properties...", len(pfIDs))
+
+	// Fetch all listings to get image URLs
+	// We'll need to fetch all pages to find our properties
+	allListings := make(map[string]property.PFListing)
+	pager := client.NewListingPager()
+
+	for {
+		listings, err := pager.Next(ctx)
+		if err != nil {
+			log.Printf("Error fetching listings page %d: %v", pager.Page()+1, err)
+			break
+		}
+		if listings == nil {
+			break
+		}
+
+		for _, listing := range listings {
+			allListings[listing.ID] = listing
+		}
+	}
+
+	log.Printf("Fetched %d listings from API", len(allListings))
+
+	if repairPlan != nil {
+		repairPlan.Complete = pager.Complete()
+		planRepairs(ctx, dbConn, repairPlan, missingByProperty, allListings)
+		return result, nil
+	}
+
+	// Process each property with missing images
+	// Counters are shared with the goroutine saving finished downloads
+	var repairedCount, failedCount atomic.Int64
+
+	pool := media.NewPool(ctx, media.PoolOptions{})
+	repairsDone := make(chan struct{})
+	go func() {
+		saveRepairedImages(ctx, dbConn, pool, &repairedCount, &failedCount)
+		close(repairsDone)
+	}()
+
+	for propertyID, missingList := range missingByProperty {
+		if ctx.Err() != nil {
+			break
+		}
+
+		// Get property to find pf_id
+		var prop property.DjangoProperty
+		err := dbConn.WithContext(ctx).Where("id = ?", propertyID).First(&prop).Error
+		if err != nil {
+			log.Printf("Property %d not found in database, skipping", propertyID)
+			failedCount.Add(int64(len(missingList)))
+			continue
+		}
+
+		// Find listing in fetched listings
+		listing, found := allListings[prop.PfID]
+		if !found {
+			log.Printf("Listing %s (pf_id) not found in API response for property %d, skipping", prop.PfID, propertyID)
+			failedCount.Add(int64(len(missingList)))
+			continue
+		}
+
+		// Get all image URLs from listing, keeping their positions
+		imageURLs := listingImageURLs(listing)
+
+		sources, err := db.GetImageSources(ctx, dbConn, missingImageIDs(missingList))
+		if err != nil {
+			log.Printf("Failed to load image sources for property %d: %v", propertyID, err)
+			failedCount.Add(int64(len(missingList)))
+			continue
+		}
+
+		// Re-download exactly the image each record was created from
+		log.Printf("Repairing %d missing images for property %d (pf_id: %s)", len(missingList), propertyID, prop.PfID)
+
+		for _, missing := range missingList {
+			if ctx.Err() != nil {
+				break
+			}
+
+			urlIndex := matchMissingImage(missing, sources, imageURLs)
+			if urlIndex < 0 {
+				log.Printf("No matching image in listing for property %d, image %s, skipping", propertyID, missing.ImagePath)
+				failedCount.Add(1)
+				continue
+			}
+
+			// Queue the download; the record is relinked once it finishes
+			if !pool.Submit(media.ImageJob{
+				URL:        imageURLs[urlIndex],
+				PropertyID: propertyID,
+				Index:      urlIndex,
+				Key:        prop.PfID,
+				ImageID:    missing.ImageID,
+			}) {
+				break
+			}
+		}
+	}
+
+	// Wait for queued downloads to finish
+	pool.Close()
+	<-repairsDone
+
+	result.ImagesRepaired = int(repairedCount.Load())
+	result.ImagesFailed = int(failedCount.Load())
+	return result, nil
+}
+
+// saveRepairedImages points the missing image records at the downloaded files
+// until the pool is closed
+func saveRepairedImages(ctx context.Context, dbConn *gorm.DB, pool *media.Pool, repairedCount, failedCount *atomic.Int64) {
+	// Not cancelled with ctx so each relink completes or rolls back as a whole
+	dbCtx := context.WithoutCancel(ctx)
+
+	for res := range pool.Results() {
+		job := res.Job
+
+		if res.Err != nil {
+			if ctx.Err() != nil {
+				continue
+			}
+			log.Printf("Failed to download image for property %d, URL: %s, error: %v", job.PropertyID, job.URL, res.Err)
+			failedCount.Add(1)
+			continue
+		}
+
+		localPath := res.Path
+		err := db.RelinkPropertyImage(dbCtx, dbConn, job.ImageID, job.PropertyID, localPath, job.URL, res.Hash)
+		if err != nil {
+			log.Printf("Failed to relink image record %d for property %d, path: %s, error: %v", job.ImageID, job.PropertyID, localPath, err)
+			failedCount.Add(1)
+			continue
+		}
+
+		log.Printf("Successfully repaired image for property %d: %s", job.PropertyID, localPath)
+		repairedCount.Add(1)
+	}
+}
+
+// planRepairs records the re-download Images would queue for each missing image.
+// It follows the same URL choice as the repair loop.
+func planRepairs(
+	ctx context.Context,
+	dbConn *gorm.DB,
+	repairPlan *plan.Plan,
+	missingByProperty map[uint][]db.MissingImageInfo,
+	allListings map[string]property.PFListing,
+) {
+	// Sorted so the plan is stable between runs
+	propertyIDs := make([]uint, 0, len(missingByProperty))
+	for propertyID := range missingByProperty {
+		propertyIDs = append(propertyIDs, propertyID)
+	}
+	sort.Slice(propertyIDs, func(i, j int) bool { return propertyIDs[i] < propertyIDs[j] })
+
+	for _, propertyID := range propertyIDs {
+		missingList := missingByProperty[propertyID]
+		key := strconv.FormatUint(uint64(propertyID), 10)
+
+		var prop property.DjangoProperty
+		if err := dbConn.WithContext(ctx).Where("id = ?", propertyID).First(&prop).Error; err != nil {
+			repairPlan.Skipped = append(repairPlan.Skipped, plan.Skip{Key: key, Reason: "property not found in database"})
+			continue
+		}
+
+		listing, found := allListings[prop.PfID]
+		if !found {
+			repairPlan.Skipped = append(repairPlan.Skipped, plan.Skip{Key: prop.PfID, Reason: "listing not found in API response"})
+			continue
+		}
+
+		imageURLs := listingImageURLs(listing)
+
+		sources, err := db.GetImageSources(ctx, dbConn, missingImageIDs(missingList))
+		if err != nil {
+			repairPlan.Skipped = append(repairPlan.Skipped, plan.Skip{Key: prop.PfID, Reason: "failed to load image sources: " + err.Error()})
+			continue
+		}
+
+		for _, missing := range missingList {
+			urlIndex := matchMissingImage(missing, sources, imageURLs)
+			if urlIndex < 0 {
+				repairPlan.Skipped = append(repairPlan.Skipped, plan.Skip{Key: missing.ImagePath, Reason: "no matching image in listing"})
+				continue
+			}
+
+			repairPlan.Images = append(repairPlan.Images, plan.Image{
+				Action:     "redownload",
+				PfID:       prop.PfID,
+				PropertyID: propertyID,
+				ImageID:    missing.ImageID,
+				URL:        imageURLs[urlIndex],
+				Path:       missing.ImagePath,
+			})
+		}
+	}
+}
+
+// listingImageURLs returns the listing's original image URLs in listing order
+func listingImageURLs(listing property.PFListing) []string {
+	imageURLs := make([]string, len(listing.Media.Images))
+	for idx, img := range listing.Media.Images {
+		imageURLs[idx] = img.Original.URL
+	}
+	return imageURLs
+}
+
+// missingImageIDs returns the image record IDs in missingList
+func missingImageIDs(missingList []db.MissingImageInfo) []uint {
+	ids := make([]uint, 0, len(missingList))
+	for _, missing := range missingList {
+		ids = append(ids, missing.ImageID)
+	}
+	return ids
+}
+
+// matchMissingImage returns the index in imageURLs of the image the missing
+// record was downloaded from, or -1
+func matchMissingImage(missing db.MissingImageInfo, sources map[uint]property.PropertyImageSource, imageURLs []string) int {
+	var src *property.PropertyImageSource
+	if row, ok := sources[missing.ImageID]; ok {
+		src = &row
+	}
+	img := property.DjangoPropertyImage{
+		ID:         missing.ImageID,
+		PropertyID: missing.PropertyID,
+		Image:      missing.ImagePath,
+	}
+	return property.MatchImageURL(img, src, imageURLs)
+}
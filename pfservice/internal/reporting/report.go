@@ -2,8 +2,11 @@ package reporting
 
 import (
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -11,10 +14,56 @@ type ReportStats struct {
 	Date              time.Time
 	PropertiesCreated int
 	PropertiesUpdated int
+	PropertiesHidden  int
 	ImagesDownloaded  int
+	ImagesRetired     int
 	UsersCreated      int
 	UsersUpdated      int
 	Errors            int
+
+	// Interrupted is set when the run was stopped by a signal before finishing
+	Interrupted bool
+	// Targeted is set when only listings selected by pf_id or reference were synced
+	Targeted bool
+	// Incremental is set when only listings updated since the last run were synced
+	Incremental bool
+
+	// PriceMovements are the price changes applied in the run
+	PriceMovements []PriceMovement
+}
+
+// PriceMovement is a property whose price changed in a run
+type PriceMovement struct {
+	PropertyID uint
+	PfID       string
+	OldPrice   int64
+	NewPrice   int64
+}
+
+// Percent returns the change relative to OldPrice, negative for a
+// reduction, or 0 when there was no old price
+func (m PriceMovement) Percent() float64 {
+	if m.OldPrice == 0 {
+		return 0
+	}
+	return float64(m.NewPrice-m.OldPrice) * 100 / float64(m.OldPrice)
+}
+
+// priceMovementsInReport is how many price movements a report row lists
+const priceMovementsInReport = 10
+
+// BiggestPriceMovements returns up to n movements with the largest change
+// in percent, up or down, largest first
+func BiggestPriceMovements(moves []PriceMovement, n int) []PriceMovement {
+	sorted := make([]PriceMovement, len(moves))
+	copy(sorted, moves)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return math.Abs(sorted[i].Percent()) > math.Abs(sorted[j].Percent())
+	})
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
 }
 
 var ReportFile = getReportFile()
@@ -65,25 +114,32 @@ func WriteReport(stats ReportStats) error {
 	dateStr := tashkentTime.Format("2006-01-02")
 	timeStr := tashkentTime.Format("15:04:05")
 
-	// Write header if file is empty or new day
-	fileInfo, _ := file.Stat()
-	if fileInfo.Size() == 0 {
+	// Write a header for a new file, or a fresh one when the columns of the
+	// existing file are from an older layout
+	current, err := currentHeader(ReportFile)
+	if err != nil {
+		return fmt.Errorf("failed to read report file: %w", err)
+	}
+	if current != reportColumns {
 		writeHeader(file)
 	}
 
 	// Write report entry as table row
-	line := fmt.Sprintf("| %s | %s | %6d | %6d | %6d | %6d | %6d | %6d |\n",
+	line := fmt.Sprintf("| %s | %s | %6d | %6d | %6d | %6d | %6d | %6d | %6d | %6d |%s\n",
 		dateStr,
 		timeStr,
 		stats.PropertiesCreated,
 		stats.PropertiesUpdated,
+		stats.PropertiesHidden,
 		stats.ImagesDownloaded,
+		stats.ImagesRetired,
 		stats.UsersCreated,
 		stats.UsersUpdated,
 		stats.Errors,
+		runMarkers(stats),
 	)
 
-	_, err = file.WriteString(line)
+	_, err = file.WriteString(line + priceMovementsSection(stats.PriceMovements))
 	if err != nil {
 		return fmt.Errorf("failed to write report: %w", err)
 	}
@@ -91,12 +147,63 @@ func WriteReport(stats ReportStats) error {
 	return nil
 }
 
+// priceMovementsSection lists the run's biggest price movements below its row
+func priceMovementsSection(moves []PriceMovement) string {
+	if len(moves) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	biggest := BiggestPriceMovements(moves, priceMovementsInReport)
+	fmt.Fprintf(&b, "|   Price movements: %d changed, biggest %d:\n", len(moves), len(biggest))
+	for _, m := range biggest {
+		fmt.Fprintf(&b, "|     %-28s %12d -> %12d  %+7.1f%%\n", m.PfID, m.OldPrice, m.NewPrice, m.Percent())
+	}
+	return b.String()
+}
+
+// runMarkers flags targeted, incremental and partial runs at the end of the report row
+func runMarkers(stats ReportStats) string {
+	markers := ""
+	if stats.Targeted {
+		markers += " TARGETED"
+	}
+	if stats.Incremental {
+		markers += " INCREMENTAL"
+	}
+	if stats.Interrupted {
+		markers += " INTERRUPTED"
+	}
+	return markers
+}
+
+const (
+	reportBorder  = "+------------+----------+--------------+--------------+-------------+------------------+----------------+--------------+--------------+--------+"
+	reportColumns = "|    Date    |   Time   | Prop Created | Prop Updated | Prop Hidden | Images Downloaded | Images Retired | User Created | User Updated | Errors |"
+)
+
+// currentHeader returns the column line of the last header in the report
+// file, or "" when the file is missing or has none
+func currentHeader(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	lines := strings.Split(string(data), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		if strings.HasPrefix(lines[i], "|    Date    |") {
+			return lines[i], nil
+		}
+	}
+	return "", nil
+}
+
 func writeHeader(file *os.File) {
-	header := `+------------+----------+--------------+--------------+------------------+--------------+--------------+--------+
-|    Date    |   Time   | Prop Created | Prop Updated | Images Downloaded | User Created | User Updated | Errors |
-+------------+----------+--------------+--------------+------------------+--------------+--------------+--------+
-`
-	file.WriteString(header)
+	file.WriteString(reportBorder + "\n" + reportColumns + "\n" + reportBorder + "\n")
 }
 
 // WriteSummary writes a summary line at the end
@@ -113,14 +220,16 @@ func WriteSummary(stats ReportStats) error {
 	}
 
 	summary := fmt.Sprintf(`
-+------------+----------+------------+------------+----------------+------------+------------+--------+
-| SUMMARY    | %s | %6d | %6d | %6d | %6d | %6d | %6d |
-+------------+----------+------------+------------+----------------+------------+------------+--------+
++------------+----------+------------+------------+-------------+----------------+----------------+------------+------------+--------+
+| SUMMARY    | %s | %6d | %6d | %6d | %6d | %6d | %6d | %6d | %6d |
++------------+----------+------------+------------+-------------+----------------+----------------+------------+------------+--------+
 `,
 		tashkentTime.Format("2006-01-02 15:04:05"),
 		stats.PropertiesCreated,
 		stats.PropertiesUpdated,
+		stats.PropertiesHidden,
 		stats.ImagesDownloaded,
+		stats.ImagesRetired,
 		stats.UsersCreated,
 		stats.UsersUpdated,
 		stats.Errors,
@@ -0,0 +1,96 @@
+package reporting
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBiggestPriceMovements(t *testing.T) {
+	moves := []PriceMovement{
+		{PfID: "small-drop", OldPrice: 1000000, NewPrice: 980000},
+		{PfID: "big-rise", OldPrice: 1000000, NewPrice: 1300000},
+		{PfID: "big-drop", OldPrice: 1000000, NewPrice: 600000},
+		{PfID: "no-old-price", OldPrice: 0, NewPrice: 500000},
+	}
+
+	biggest := BiggestPriceMovements(moves, 2)
+	if len(biggest) != 2 {
+		t.Fatalf("Expected 2 movements, got %d", len(biggest))
+	}
+	if biggest[0].PfID != "big-drop" || biggest[1].PfID != "big-rise" {
+		t.Errorf("Expected big-drop then big-rise, got %s, %s", biggest[0].PfID, biggest[1].PfID)
+	}
+	if got := biggest[0].Percent(); got != -40 {
+		t.Errorf("Expected -40%%, got %v", got)
+	}
+	if moves[0].PfID != "small-drop" {
+		t.Error("Input slice should not be reordered")
+	}
+}
+
+func TestWriteReportListsPriceMovements(t *testing.T) {
+	oldReportFile := ReportFile
+	ReportFile = filepath.Join(t.TempDir(), "report.txt")
+	defer func() {
+		ReportFile = oldReportFile
+	}()
+
+	err := WriteReport(ReportStats{
+		PropertiesUpdated: 1,
+		PriceMovements: []PriceMovement{
+			{PropertyID: 1061, PfID: "pf-1061", OldPrice: 1500000, NewPrice: 1350000},
+		},
+	})
+	if err != nil {
+		t.Fatalf("WriteReport failed: %v", err)
+	}
+
+	data, err := os.ReadFile(ReportFile)
+	if err != nil {
+		t.Fatalf("Failed to read report: %v", err)
+	}
+	report := string(data)
+	if !strings.Contains(report, "Price movements: 1 changed") {
+		t.Errorf("Report is missing the price movements section:\n%s", report)
+	}
+	if !strings.Contains(report, "pf-1061") || !strings.Contains(report, "-10.0%") {
+		t.Errorf("Report is missing the movement of pf-1061:\n%s", report)
+	}
+}
+
+func TestWriteReportRewritesOutdatedHeader(t *testing.T) {
+	oldReportFile := ReportFile
+	ReportFile = filepath.Join(t.TempDir(), "report.txt")
+	defer func() {
+		ReportFile = oldReportFile
+	}()
+
+	oldLayout := `+------------+----------+--------------+--------------+------------------+--------------+--------------+--------+
+|    Date    |   Time   | Prop Created | Prop Updated | Images Downloaded | User Created | User Updated | Errors |
++------------+----------+--------------+--------------+------------------+--------------+--------------+--------+
+| 2025-01-01 | 10:00:00 |      1 |      2 |      3 |      0 |      0 |      0 |
+`
+	if err := os.WriteFile(ReportFile, []byte(oldLayout), 0644); err != nil {
+		t.Fatalf("Failed to write old report: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := WriteReport(ReportStats{PropertiesHidden: 1}); err != nil {
+			t.Fatalf("WriteReport failed: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(ReportFile)
+	if err != nil {
+		t.Fatalf("Failed to read report: %v", err)
+	}
+	report := string(data)
+	if !strings.HasPrefix(report, oldLayout) {
+		t.Errorf("Existing rows should be kept:\n%s", report)
+	}
+	if n := strings.Count(report, reportColumns); n != 1 {
+		t.Errorf("Expected the current header once, got %d:\n%s", n, report)
+	}
+}
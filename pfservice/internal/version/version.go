@@ -0,0 +1,40 @@
+// Package version reports the git version the binaries were built from.
+package version
+
+import "runtime/debug"
+
+// Version is set at build time with
+// -ldflags "-X pfservice/internal/version.Version=$(git describe --always --dirty)"
+var Version = ""
+
+// String returns Version, else the VCS revision embedded by the Go
+// toolchain, else "dev"
+func String() string {
+	if Version != "" {
+		return Version
+	}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "dev"
+	}
+	revision, modified := "", false
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+	if revision == "" {
+		return "dev"
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if modified {
+		revision += "-dirty"
+	}
+	return revision
+}